@@ -19,6 +19,10 @@ type PixelCell struct {
 	latitude    float64
 	longitude   float64
 	geoCoverage *terrain.GeoCoverage
+	// The surrounding terrain, for the neighborhood based values
+	elevationMap *terrain.ElevationMap
+	x, y         int
+	pixelSize    float64
 }
 
 func (c *PixelCell) Elevation() float32 {
@@ -26,10 +30,15 @@ func (c *PixelCell) Elevation() float32 {
 }
 
 func (c *PixelCell) IsLand() bool {
-	if c.elevation < -420 {
+	return isLand(c.elevation, c.longitude, c.latitude, c.geoCoverage)
+}
+
+// isLand classifies a location by its elevation, only elevations around sea level need the land polygons
+func isLand(elevation float32, longitude, latitude float64, geoCoverage *terrain.GeoCoverage) bool {
+	if elevation < -420 {
 		return false
 	}
-	return c.elevation > 100 || c.geoCoverage.IsPointInLand(c.longitude, c.latitude)
+	return elevation > 100 || geoCoverage.IsPointInLand(longitude, latitude)
 }
 
 func (c *PixelCell) Latitude() float64 {
@@ -66,16 +75,35 @@ func (c *PixelCell) AquatorFactor() float64 {
 	return math.Max(0, math.Min(1, (math.Abs(c.Latitude())/polarAbsoluteLatitude)))
 }
 
-func GetCellsForTile(elevationMap *terrain.ElevationMap, tile *TileBounds, geoCoverage *terrain.GeoCoverage) ([][]*PixelCell, error) {
+func (c *PixelCell) Slope() float64 {
+	slope, _ := terrain.SlopeAspect(c.elevationMap.Gradient(c.x, c.y, c.pixelSize, terrain.SlopeHorn))
+	return slope
+}
+
+func (c *PixelCell) Aspect() float64 {
+	_, aspect := terrain.SlopeAspect(c.elevationMap.Gradient(c.x, c.y, c.pixelSize, terrain.SlopeHorn))
+	return aspect
+}
+
+func (c *PixelCell) Curvature() float64 {
+	return c.elevationMap.Curvature(c.x, c.y, c.pixelSize)
+}
+
+func GetCellsForTile(elevationMap *terrain.ElevationMap, tile *terrain.TileBounds, geoCoverage *terrain.GeoCoverage) ([][]*PixelCell, error) {
 	cells := make([][]*PixelCell, elevationMap.TileSize)
 	for y := 0; y < elevationMap.TileSize; y++ {
 		cells[y] = make([]*PixelCell, elevationMap.TileSize)
+		pixelSize := tile.GetPixelSize(y)
 		for x := 0; x < elevationMap.TileSize; x++ {
 			cells[y][x] = &PixelCell{
-				elevation:   elevationMap.GetElevation(x, y),
-				latitude:    tile.GetPixelLat(y),
-				longitude:   tile.GetPixelLng(x),
-				geoCoverage: geoCoverage,
+				elevation:    elevationMap.GetElevation(x, y),
+				latitude:     tile.GetPixelLat(y),
+				longitude:    tile.GetPixelLng(x),
+				geoCoverage:  geoCoverage,
+				elevationMap: elevationMap,
+				x:            x,
+				y:            y,
+				pixelSize:    pixelSize,
 			}
 		}
 	}
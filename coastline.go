@@ -6,28 +6,18 @@ import (
 	"github.com/mxzinke/colorful-terrarium/terrain"
 )
 
-// Mix original and smoothed elevations
-const mixFactor float32 = 0.5
-
-// smoothCoastlines applies intelligent smoothing to coastline areas
-func smoothCoastlines(elevation float32, x, y int, elevMap *terrain.ElevationMap, zoom uint32) float32 {
-	// Skip smoothing for low zoom levels
-	if zoom < 7 {
-		return elevation
-	}
-
+// smoothCoastlines applies intelligent smoothing to coastline areas, mixing the original and the
+// smoothed elevation of the neighborhood by the mix factor
+func smoothCoastlines(elevation float32, x, y int, elevMap *terrain.ElevationMap, radius int, mixFactor float32) float32 {
 	// Only smooth on coastlines
 	if math.Abs(float64(elevation)) > 200 {
 		return elevation
 	}
 
-	// Calculate pattern size based on zoom level
-	patternSize := int(math.Pow(2, math.Max(float64(zoom-7), 0)))
-
 	// Quick check for coastline using neighborhood stats
-	landCount, waterCount, hasEdge := elevMap.GetNeighborhoodStats(x, y, patternSize)
+	landCount, waterCount, hasEdge := elevMap.GetNeighborhoodStats(x, y, radius)
 
-	// Skip smoothing at tile edges to prevent artifacts
+	// Skip smoothing where the neighborhood exceeds the buffer of the tile, to prevent artifacts
 	if hasEdge {
 		return elevation
 	}
@@ -45,9 +35,6 @@ func smoothCoastlines(elevation float32, x, y int, elevMap *terrain.ElevationMap
 	var totalWeight float32
 	centerIsLand := elevMap.IsAboveSeaLevel(x, y)
 
-	// Sample radius increases with zoom level
-	radius := patternSize
-
 	// Collect and weight neighboring elevations
 	for dy := -radius; dy <= radius; dy++ {
 		for dx := -radius; dx <= radius; dx++ {
@@ -58,6 +58,8 @@ var (
 		},
 	}
 
+	rockColor = colors.Color{R: 146, G: 142, B: 136, A: 255}
+
 	desertPalette = colors.ColorPalette{
 		Stops: []colors.ColorStop{
 			{Elevation: 0, Color: colors.Color{R: 235, G: 230, B: 185, A: 255}},    // Beach
@@ -70,23 +72,62 @@ var (
 			{Elevation: 4000, Color: colors.Color{R: 255, G: 255, B: 255, A: 255}}, // Permanent snow
 		},
 	}
+
+	// Lookup tables of the palettes, to avoid the interpolation per pixel
+	desertLUT = colors.NewPaletteLUT(desertPalette)
+	normalLUT = colors.NewPaletteLUT(normalPalette)
+	polarLUT  = colors.NewPaletteLUT(polarPalette)
+	waterLUT  = colors.NewPaletteLUT(waterPalette)
 )
 
 type ColorV1Provider struct {
+	hillshade *colors.HillshadeOptions
 }
 
 func NewColorV1Provider() *ColorV1Provider {
 	return &ColorV1Provider{}
 }
 
+// NewShadedColorV1Provider creates the provider with the hillshade multiplied into the colors
+func NewShadedColorV1Provider(options colors.HillshadeOptions) *ColorV1Provider {
+	return &ColorV1Provider{hillshade: &options}
+}
+
 func (p *ColorV1Provider) Name() string {
+	if p.hillshade != nil {
+		return "color-v1-shaded"
+	}
 	return "color-v1"
 }
 
+func (p *ColorV1Provider) HillshadeOptions() *colors.HillshadeOptions {
+	return p.hillshade
+}
+
+// ElevationOptions smooths the coastlines on top of the default post-processing
+func (p *ColorV1Provider) ElevationOptions() colors.ElevationOptions {
+	options := colors.DefaultElevationOptions()
+	coastlines := colors.DefaultCoastlineOptions()
+	options.Coastlines = &coastlines
+	return options
+}
+
+func (p *ColorV1Provider) Version() string {
+	if p.hillshade != nil {
+		return "2-" + p.hillshade.String()
+	}
+	return "2"
+}
+
 func (p *ColorV1Provider) FileType() string {
 	return "png"
 }
 
+// Formats serves the tiles as PNG, WebP and JPEG
+func (p *ColorV1Provider) Formats() []colors.EncoderOptions {
+	return colors.DefaultColorFormats
+}
+
 func (p *ColorV1Provider) MaxZoom() uint32 {
 	return 13
 }
@@ -111,9 +152,9 @@ func (p *ColorV1Provider) GetImage(ctx context.Context, imgRect image.Rectangle,
 
 			if !cell.IsLand() {
 				if !cell.IsIce() {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, waterPalette).RGBA())
+					output.SetNRGBA(x, y, waterLUT.Color(elevation).RGBA())
 				} else {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+					output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				}
 				continue
 			}
@@ -123,20 +164,20 @@ func (p *ColorV1Provider) GetImage(ctx context.Context, imgRect image.Rectangle,
 
 			polarFactor := cell.PolarFactor()
 			if polarFactor == 1 {
-				output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+				output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				continue
 			} else if polarFactor > 0 {
-				polarColor := colors.GetColorFromPalette(elevation, polarPalette)
+				polarColor := polarLUT.Color(elevation)
 
 				if cell.IsIce() {
-					output.Set(x, y, polarColor.RGBA())
+					output.SetNRGBA(x, y, polarColor.RGBA())
 					continue
 				}
 
-				normalColor := colors.GetColorFromPalette(elevation, normalPalette)
+				normalColor := normalLUT.Color(elevation)
 
 				// Interpolate between normal and polar colors
-				output.Set(x, y, img_color.NRGBA{
+				output.SetNRGBA(x, y, img_color.NRGBA{
 					R: uint8(math.Round(float64(normalColor.R)*(1-float64(polarFactor)) + float64(polarColor.R)*float64(polarFactor))),
 					G: uint8(math.Round(float64(normalColor.G)*(1-float64(polarFactor)) + float64(polarColor.G)*float64(polarFactor))),
 					B: uint8(math.Round(float64(normalColor.B)*(1-float64(polarFactor)) + float64(polarColor.B)*float64(polarFactor))),
@@ -147,13 +188,13 @@ func (p *ColorV1Provider) GetImage(ctx context.Context, imgRect image.Rectangle,
 
 			desertFactor := cell.DesertFactor()
 			if desertFactor == 1 {
-				output.Set(x, y, colors.GetColorFromPalette(elevation, desertPalette).RGBA())
+				output.SetNRGBA(x, y, desertLUT.Color(elevation).RGBA())
 				continue
 			} else if desertFactor > 0 {
-				normalColor := colors.GetColorFromPalette(elevation, normalPalette)
-				desertColor := colors.GetColorFromPalette(elevation, desertPalette)
+				normalColor := normalLUT.Color(elevation)
+				desertColor := desertLUT.Color(elevation)
 
-				output.Set(x, y, img_color.NRGBA{
+				output.SetNRGBA(x, y, img_color.NRGBA{
 					R: uint8(math.Round(float64(normalColor.R)*(1-float64(desertFactor)) + float64(desertColor.R)*float64(desertFactor))),
 					G: uint8(math.Round(float64(normalColor.G)*(1-float64(desertFactor)) + float64(desertColor.G)*float64(desertFactor))),
 					B: uint8(math.Round(float64(normalColor.B)*(1-float64(desertFactor)) + float64(desertColor.B)*float64(desertFactor))),
@@ -163,17 +204,42 @@ func (p *ColorV1Provider) GetImage(ctx context.Context, imgRect image.Rectangle,
 			}
 
 			if cell.IsIce() {
-				output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+				output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				continue
 			}
 
-			output.Set(x, y, colors.GetColorFromPalette(elevation, normalPalette).RGBA())
+			output.SetNRGBA(x, y, steepRockColor(normalLUT.Color(elevation), cell.Slope()).RGBA())
 		}
 	}
 
+	if p.hillshade != nil && input.Hillshade != nil {
+		colors.ApplyHillshade(output, input.Hillshade, *p.hillshade)
+	}
+
 	return output, nil
 }
 
+// Slopes in degrees between which the land fades into bare rock
+const (
+	rockStartSlope = 30
+	rockFullSlope  = 45
+)
+
+// steepRockColor blends the color into grey rock on steep slopes
+func steepRockColor(color colors.Color, slope float64) colors.Color {
+	factor := math.Max(0, math.Min(1, (slope-rockStartSlope)/(rockFullSlope-rockStartSlope)))
+	if factor == 0 {
+		return color
+	}
+
+	return colors.Color{
+		R: uint8(math.Round(float64(color.R)*(1-factor) + float64(rockColor.R)*factor)),
+		G: uint8(math.Round(float64(color.G)*(1-factor) + float64(rockColor.G)*factor)),
+		B: uint8(math.Round(float64(color.B)*(1-factor) + float64(rockColor.B)*factor)),
+		A: color.A,
+	}
+}
+
 func (p *ColorV1Provider) EncodeImage(w io.Writer, img image.Image) error {
 	return colors.EncodePNGOptimized(w, img)
 }
@@ -56,23 +56,61 @@ var (
 			{Elevation: 3000, Color: colors.Color{R: 245, G: 251, B: 252, A: 255}}, // High permanent snow
 		},
 	}
+
+	// Lookup tables of the palettes, to avoid the interpolation per pixel
+	normalLUT = colors.NewPaletteLUT(normalPalette)
+	polarLUT  = colors.NewPaletteLUT(polarPalette)
+	waterLUT  = colors.NewPaletteLUT(waterPalette)
 )
 
 type ColorV2Provider struct {
+	hillshade *colors.HillshadeOptions
 }
 
 func NewColorV2Provider() *ColorV2Provider {
 	return &ColorV2Provider{}
 }
 
+// NewShadedColorV2Provider creates the provider with the hillshade multiplied into the colors
+func NewShadedColorV2Provider(options colors.HillshadeOptions) *ColorV2Provider {
+	return &ColorV2Provider{hillshade: &options}
+}
+
 func (p *ColorV2Provider) Name() string {
+	if p.hillshade != nil {
+		return "color-v2-shaded"
+	}
 	return "color-v2"
 }
 
+func (p *ColorV2Provider) HillshadeOptions() *colors.HillshadeOptions {
+	return p.hillshade
+}
+
+// ElevationOptions smooths the coastlines on top of the default post-processing
+func (p *ColorV2Provider) ElevationOptions() colors.ElevationOptions {
+	options := colors.DefaultElevationOptions()
+	coastlines := colors.DefaultCoastlineOptions()
+	options.Coastlines = &coastlines
+	return options
+}
+
+func (p *ColorV2Provider) Version() string {
+	if p.hillshade != nil {
+		return "1-" + p.hillshade.String()
+	}
+	return "1"
+}
+
 func (p *ColorV2Provider) FileType() string {
 	return "png"
 }
 
+// Formats serves the tiles as PNG, WebP and JPEG
+func (p *ColorV2Provider) Formats() []colors.EncoderOptions {
+	return colors.DefaultColorFormats
+}
+
 func (p *ColorV2Provider) MaxZoom() uint32 {
 	return 13
 }
@@ -97,22 +135,26 @@ func (p *ColorV2Provider) GetImage(ctx context.Context, imgRect image.Rectangle,
 
 			if !cell.IsLand() {
 				if !cell.IsIce() {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, waterPalette).RGBA())
+					output.SetNRGBA(x, y, waterLUT.Color(elevation).RGBA())
 				} else {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+					output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				}
 				continue
 			}
 
 			if cell.IsIce() {
-				output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+				output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				continue
 			}
 
-			output.Set(x, y, colors.GetColorFromPalette(elevation, normalPalette).RGBA())
+			output.SetNRGBA(x, y, normalLUT.Color(elevation).RGBA())
 		}
 	}
 
+	if p.hillshade != nil && input.Hillshade != nil {
+		colors.ApplyHillshade(output, input.Hillshade, *p.hillshade)
+	}
+
 	return output, nil
 }
 
@@ -39,6 +39,11 @@ var (
 			{Elevation: 100, Color: colors.Color{R: 250, G: 250, B: 250, A: 255}}, // Snow lowlands
 		},
 	}
+
+	// Lookup tables of the palettes, to avoid the interpolation per pixel
+	normalLUT = colors.NewPaletteLUT(normalPalette)
+	polarLUT  = colors.NewPaletteLUT(polarPalette)
+	waterLUT  = colors.NewPaletteLUT(waterPalette)
 )
 
 type CustomerProvider struct {
@@ -52,10 +57,19 @@ func (p *CustomerProvider) Name() string {
 	return "custom-ikarus"
 }
 
+func (p *CustomerProvider) Version() string {
+	return "1"
+}
+
 func (p *CustomerProvider) FileType() string {
 	return "png"
 }
 
+// Formats serves the tiles as PNG, WebP and JPEG
+func (p *CustomerProvider) Formats() []colors.EncoderOptions {
+	return colors.DefaultColorFormats
+}
+
 func (p *CustomerProvider) MaxZoom() uint32 {
 	return 13
 }
@@ -80,19 +94,19 @@ func (p *CustomerProvider) GetImage(ctx context.Context, imgRect image.Rectangle
 
 			if !cell.IsLand() {
 				if !cell.IsIce() {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, waterPalette).RGBA())
+					output.SetNRGBA(x, y, waterLUT.Color(elevation).RGBA())
 				} else {
-					output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+					output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				}
 				continue
 			}
 
 			if cell.IsIce() {
-				output.Set(x, y, colors.GetColorFromPalette(elevation, polarPalette).RGBA())
+				output.SetNRGBA(x, y, polarLUT.Color(elevation).RGBA())
 				continue
 			}
 
-			output.Set(x, y, colors.GetColorFromPalette(elevation, normalPalette).RGBA())
+			output.SetNRGBA(x, y, normalLUT.Color(elevation).RGBA())
 		}
 	}
 
@@ -0,0 +1,82 @@
+package colors
+
+import (
+	"fmt"
+	"math"
+)
+
+// FixElevationOptions configures the correction of sea areas with wrong elevation in the source data
+type FixElevationOptions struct {
+	// MaxZoom is the highest zoom level at which the elevation is corrected
+	MaxZoom uint32
+}
+
+// CoastlineOptions configures the smoothing of the elevation along coastlines
+type CoastlineOptions struct {
+	// MinZoom and MaxZoom limit the zoom levels at which coastlines are smoothed
+	MinZoom uint32
+	MaxZoom uint32
+	// MixFactor is the share of the smoothed elevation in the result (0 to 1)
+	MixFactor float32
+	// Radius is the neighborhood in pixels, 0 starts with 1 at MinZoom and doubles with each zoom level.
+	// Neighborhoods exceeding the tile buffer are not smoothed.
+	Radius int
+}
+
+// DefaultCoastlineOptions returns the smoothing for the zoom levels in which the radius fits into the default tile buffer
+func DefaultCoastlineOptions() CoastlineOptions {
+	return CoastlineOptions{
+		MinZoom:   7,
+		MaxZoom:   10,
+		MixFactor: 0.5,
+	}
+}
+
+// RadiusForZoom returns the neighborhood radius used at the zoom level
+func (o CoastlineOptions) RadiusForZoom(zoom uint32) int {
+	if o.Radius > 0 {
+		return o.Radius
+	}
+	return 1 << min(max(zoom, o.MinZoom)-o.MinZoom, 16)
+}
+
+// ElevationOptions configures the post-processing stages applied to the elevation map before the colors are
+// calculated, in this order. A nil stage is disabled.
+type ElevationOptions struct {
+	Fix        *FixElevationOptions
+	Coastlines *CoastlineOptions
+}
+
+// DefaultElevationOptions returns the post-processing of providers not implementing ElevationProvider:
+// the elevation is corrected at all zoom levels, coastlines aren't smoothed
+func DefaultElevationOptions() ElevationOptions {
+	return ElevationOptions{
+		Fix: &FixElevationOptions{MaxZoom: math.MaxUint32},
+	}
+}
+
+// String identifies the options (e.g. as part of a provider version)
+func (o ElevationOptions) String() string {
+	fix, coastlines := "off", "off"
+	if o.Fix != nil {
+		fix = fmt.Sprintf("%d", o.Fix.MaxZoom)
+	}
+	if o.Coastlines != nil {
+		coastlines = fmt.Sprintf("%d-%d-%g-%d", o.Coastlines.MinZoom, o.Coastlines.MaxZoom, o.Coastlines.MixFactor, o.Coastlines.Radius)
+	}
+	return fmt.Sprintf("fix-%s-coast-%s", fix, coastlines)
+}
+
+// ElevationProvider is implemented by providers which configure the elevation post-processing
+type ElevationProvider interface {
+	// ElevationOptions returns the post-processing stages of the provider
+	ElevationOptions() ElevationOptions
+}
+
+// ProviderElevationOptions returns the post-processing of the provider, or the defaults if it has none
+func ProviderElevationOptions(provider ColorProvider) ElevationOptions {
+	if elevationProvider, ok := provider.(ElevationProvider); ok {
+		return elevationProvider.ElevationOptions()
+	}
+	return DefaultElevationOptions()
+}
@@ -0,0 +1,171 @@
+package colors
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/gen2brain/webp"
+)
+
+// ImageFormat is an output format of the tiles
+type ImageFormat string
+
+const (
+	FormatPNG  ImageFormat = "png"
+	FormatJPEG ImageFormat = "jpeg"
+	FormatWebP ImageFormat = "webp"
+)
+
+const (
+	// defaultJPEGQuality is the JPEG quality if none is set
+	defaultJPEGQuality = 85
+	// defaultWebPQuality is the lossy WebP quality if none is set
+	defaultWebPQuality = 80
+	// defaultWebPMethod is the WebP effort if none is set, the default of libwebp
+	defaultWebPMethod = 4
+)
+
+// ImageEncoder encodes the tiles of a provider served with the file extension
+type ImageEncoder interface {
+	// Extension is the file extension of the encoded tiles (e.g. "png", "jpg", "webp")
+	Extension() string
+	// Encode encodes the final image
+	Encode(w io.Writer, img image.Image) error
+}
+
+// EncoderOptions configures the encoder of an image format
+type EncoderOptions struct {
+	// Format is "png", "jpeg" (or "jpg") or "webp"
+	Format ImageFormat `json:"format" yaml:"format"`
+	// Quality of lossy encodings from 1 to 100, 0 uses the default (JPEG 85, WebP 80)
+	Quality int `json:"quality,omitempty" yaml:"quality,omitempty"`
+	// Lossless uses the lossless WebP encoding, quality is ignored
+	Lossless bool `json:"lossless,omitempty" yaml:"lossless,omitempty"`
+	// Method is the WebP effort from 0 (fast) to 6 (slow, smaller tiles), nil uses 4
+	Method *int `json:"method,omitempty" yaml:"method,omitempty"`
+}
+
+// Validate returns an error for unknown formats and options which don't apply to the format
+func (o EncoderOptions) Validate() error {
+	switch o.Format {
+	case FormatPNG, FormatJPEG, "jpg", FormatWebP:
+	default:
+		return fmt.Errorf("unknown image format %q, expected png, jpeg or webp", o.Format)
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if o.Quality != 0 && (o.Format == FormatPNG || o.Lossless) {
+		return fmt.Errorf("quality is not supported by lossless %s", o.Format)
+	}
+	if o.Lossless && o.Format != FormatWebP {
+		return fmt.Errorf("lossless is only supported by webp")
+	}
+	if o.Method != nil && o.Format != FormatWebP {
+		return fmt.Errorf("method is only supported by webp")
+	}
+	if o.Method != nil && (*o.Method < 0 || *o.Method > 6) {
+		return fmt.Errorf("method must be between 0 and 6")
+	}
+	return nil
+}
+
+// Extension returns the file extension of the format
+func (o EncoderOptions) Extension() string {
+	switch o.Format {
+	case FormatJPEG, "jpg":
+		return "jpg"
+	default:
+		return string(o.Format)
+	}
+}
+
+// Encode encodes the image in the format. JPEG has no transparency, transparent pixels turn black.
+func (o EncoderOptions) Encode(w io.Writer, img image.Image) error {
+	switch o.Format {
+	case FormatPNG:
+		return EncodePNGOptimized(w, img)
+	case FormatJPEG, "jpg":
+		quality := o.Quality
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatWebP:
+		options := webp.Options{Lossless: o.Lossless, Quality: o.Quality, Method: defaultWebPMethod}
+		if options.Quality == 0 {
+			options.Quality = defaultWebPQuality
+		}
+		if o.Method != nil {
+			options.Method = *o.Method
+		}
+		return webp.Encode(w, img, options)
+	default:
+		return fmt.Errorf("unknown image format %q", o.Format)
+	}
+}
+
+// DefaultColorFormats are the formats of the built-in color themes: PNG, lossy WebP and JPEG
+var DefaultColorFormats = []EncoderOptions{
+	{Format: FormatPNG},
+	{Format: FormatWebP},
+	{Format: FormatJPEG},
+}
+
+// MultiFormatProvider is implemented by providers which serve their tiles in several formats, each
+// with its own file extension
+type MultiFormatProvider interface {
+	// Formats returns the encoders of the provider, the first is the one of FileType and EncodeImage
+	Formats() []EncoderOptions
+}
+
+// providerEncoder is the encoder of providers with a single format
+type providerEncoder struct {
+	provider ColorProvider
+}
+
+func (e providerEncoder) Extension() string {
+	return e.provider.FileType()
+}
+
+func (e providerEncoder) Encode(w io.Writer, img image.Image) error {
+	return e.provider.EncodeImage(w, img)
+}
+
+// ProviderEncoders returns the encoders of all formats of the provider, only FileType and EncodeImage if it
+// doesn't implement MultiFormatProvider
+func ProviderEncoders(provider ColorProvider) []ImageEncoder {
+	multi, ok := provider.(MultiFormatProvider)
+	if !ok {
+		return []ImageEncoder{providerEncoder{provider}}
+	}
+
+	formats := multi.Formats()
+	encoders := make([]ImageEncoder, len(formats))
+	for i, format := range formats {
+		encoders[i] = format
+	}
+	return encoders
+}
+
+// ValidateFormats validates the formats of a provider, which need at least one format and unique extensions
+func ValidateFormats(formats []EncoderOptions) error {
+	if len(formats) == 0 {
+		return fmt.Errorf("no image formats")
+	}
+
+	extensions := make(map[string]bool, len(formats))
+	for _, format := range formats {
+		if err := format.Validate(); err != nil {
+			return err
+		}
+		if extensions[format.Extension()] {
+			return fmt.Errorf("image format %s is configured more than once", format.Extension())
+		}
+		extensions[format.Extension()] = true
+	}
+	return nil
+}
@@ -7,8 +7,9 @@ import (
 	"math"
 )
 
-// GetColorFromPalette returns a color from a palette based on the elevation. This is a simple linear interpolation between the two closest color stops.
-// It also applies a smoothstep function to the interpolation factor to create a smoother transition between colors.
+// GetColorFromPalette returns a color from a palette based on the elevation, interpolated between the two closest
+// color stops as configured by the Interpolation of the palette. By default a smoothstep function is applied to the
+// interpolation factor and the colors are blended with gamma correction, to create a smooth transition between colors.
 // This function can be used as a helper function for any color palette.
 func GetColorFromPalette(elevation float32, palette ColorPalette) Color {
 	if elevation <= palette.Stops[0].Elevation {
@@ -30,31 +31,45 @@ func GetColorFromPalette(elevation float32, palette ColorPalette) Color {
 		}
 	}
 
+	if palette.Interpolation.Mode == InterpolationDiscrete {
+		return lowStop.Color
+	}
+
 	// Calculate base interpolation factor
 	factor := (elevation - lowStop.Elevation) / (highStop.Elevation - lowStop.Elevation)
 
-	// Apply smoothstep function for smoother transitions
-	factor = factor * factor * (3 - 2*factor)
+	return palette.Interpolation.blend(lowStop.Color, highStop.Color, palette.Interpolation.ease(factor))
+}
+
+// MixColors interpolates linearly between the colors, a factor of 0 returns a and 1 returns b
+func MixColors(a, b Color, factor float64) Color {
+	return Color{
+		R: uint8(math.Round(float64(a.R)*(1-factor) + float64(b.R)*factor)),
+		G: uint8(math.Round(float64(a.G)*(1-factor) + float64(b.G)*factor)),
+		B: uint8(math.Round(float64(a.B)*(1-factor) + float64(b.B)*factor)),
+		A: uint8(math.Round(float64(a.A)*(1-factor) + float64(b.A)*factor)),
+	}
+}
 
-	// Ensure factor stays within bounds
-	factor = float32(math.Max(0, math.Min(1, float64(factor))))
+// ApplyHillshade multiplies the image colors with the hillshade. The shade is normalized to the
+// illumination of flat terrain, so flat areas keep their color and only slopes facing away from the
+// sun are darkened.
+func ApplyHillshade(img *image.NRGBA, shade [][]float32, options HillshadeOptions) {
+	flat := math.Sin(options.Altitude * math.Pi / 180)
+	if flat <= 0 {
+		return
+	}
 
-	// Calculate each color component separately with gamma correction
-	gamma := 2.2
-	r := math.Pow(float64(factor)*math.Pow(float64(highStop.Color.R)/255, gamma)+
-		(1-float64(factor))*math.Pow(float64(lowStop.Color.R)/255, gamma), 1/gamma) * 255
-	g := math.Pow(float64(factor)*math.Pow(float64(highStop.Color.G)/255, gamma)+
-		(1-float64(factor))*math.Pow(float64(lowStop.Color.G)/255, gamma), 1/gamma) * 255
-	b := math.Pow(float64(factor)*math.Pow(float64(highStop.Color.B)/255, gamma)+
-		(1-float64(factor))*math.Pow(float64(lowStop.Color.B)/255, gamma), 1/gamma) * 255
-	alpha := math.Pow(float64(factor)*math.Pow(float64(highStop.Color.A)/255, gamma)+
-		(1-float64(factor))*math.Pow(float64(lowStop.Color.A)/255, gamma), 1/gamma) * 255
+	bounds := img.Bounds()
+	for y := 0; y < len(shade) && y < bounds.Dy(); y++ {
+		for x := 0; x < len(shade[y]) && x < bounds.Dx(); x++ {
+			factor := 1 - options.Strength*(1-math.Min(1, float64(shade[y][x])/flat))
 
-	return Color{
-		R: uint8(math.Round(math.Max(0, math.Min(255, r)))),
-		G: uint8(math.Round(math.Max(0, math.Min(255, g)))),
-		B: uint8(math.Round(math.Max(0, math.Min(255, b)))),
-		A: uint8(math.Round(math.Max(0, math.Min(255, alpha)))),
+			offset := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			for i := 0; i < 3; i++ {
+				img.Pix[offset+i] = uint8(math.Round(float64(img.Pix[offset+i]) * factor))
+			}
+		}
 	}
 }
 
@@ -0,0 +1,102 @@
+package hillshade
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// HillshadeProvider renders the hillshade itself, either as grayscale image or as overlay
+// (black shadows and white highlights with alpha), to be put on top of other maps
+type HillshadeProvider struct {
+	options colors.HillshadeOptions
+	overlay bool
+}
+
+// NewHillshadeProvider creates the grayscale hillshade (like gdaldem, flat terrain is light gray)
+func NewHillshadeProvider(options colors.HillshadeOptions) *HillshadeProvider {
+	return &HillshadeProvider{options: options}
+}
+
+// NewHillshadeOverlayProvider creates the transparent hillshade overlay (flat terrain is transparent)
+func NewHillshadeOverlayProvider(options colors.HillshadeOptions) *HillshadeProvider {
+	return &HillshadeProvider{options: options, overlay: true}
+}
+
+func (p *HillshadeProvider) Name() string {
+	if p.overlay {
+		return "hillshade-overlay"
+	}
+	return "hillshade"
+}
+
+func (p *HillshadeProvider) FileType() string {
+	return "png"
+}
+
+// Formats serves the tiles as PNG, WebP and JPEG, the overlay without JPEG as it needs transparency
+func (p *HillshadeProvider) Formats() []colors.EncoderOptions {
+	if p.overlay {
+		return []colors.EncoderOptions{{Format: colors.FormatPNG}, {Format: colors.FormatWebP}}
+	}
+	return colors.DefaultColorFormats
+}
+
+// MaxZoom allows the hillshade of high resolution sources, the tiles are limited to the zoom levels of the source
+func (p *HillshadeProvider) MaxZoom() uint32 {
+	return 15
+}
+
+func (p *HillshadeProvider) HillshadeOptions() *colors.HillshadeOptions {
+	return &p.options
+}
+
+func (p *HillshadeProvider) Version() string {
+	return p.options.String()
+}
+
+func (p *HillshadeProvider) GetImage(ctx context.Context, imgRect image.Rectangle, input colors.ColorInput) (image.Image, error) {
+	if input.Hillshade == nil {
+		return nil, fmt.Errorf("hillshade is missing")
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if !p.overlay {
+		output := image.NewGray(imgRect)
+		for y, row := range input.Hillshade {
+			for x, shade := range row {
+				output.SetGray(x, y, color.Gray{Y: uint8(math.Round(float64(shade) * 255))})
+			}
+		}
+		return output, nil
+	}
+
+	// Deviation from the illumination of flat terrain, scaled by the strength
+	flat := math.Sin(p.options.Altitude * math.Pi / 180)
+	output := image.NewNRGBA(imgRect)
+	for y, row := range input.Hillshade {
+		for x, shade := range row {
+			deviation := float64(shade) - flat
+			alpha := uint8(math.Round(math.Min(1, math.Abs(deviation)/math.Max(flat, 1-flat)*p.options.Strength) * 255))
+
+			if deviation < 0 {
+				output.SetNRGBA(x, y, color.NRGBA{R: 0, G: 0, B: 0, A: alpha})
+			} else {
+				output.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: alpha})
+			}
+		}
+	}
+	return output, nil
+}
+
+func (p *HillshadeProvider) EncodeImage(w io.Writer, img image.Image) error {
+	return colors.EncodePNGOptimized(w, img)
+}
@@ -0,0 +1,235 @@
+package colors
+
+import (
+	"fmt"
+	"math"
+)
+
+// InterpolationMode is the color space in which the colors between two stops are blended
+type InterpolationMode string
+
+const (
+	// InterpolationGamma blends gamma encoded channels (the default, with a gamma of 2.2)
+	InterpolationGamma InterpolationMode = "gamma"
+	// InterpolationDiscrete keeps the color of a stop until the next stop (hypsometric bands)
+	InterpolationDiscrete InterpolationMode = "discrete"
+	// InterpolationRGB blends the sRGB channels linearly
+	InterpolationRGB InterpolationMode = "rgb"
+	// InterpolationOKLab blends in the perceptual OKLab color space
+	InterpolationOKLab InterpolationMode = "oklab"
+	// InterpolationCIELab blends in the CIELAB color space (D65)
+	InterpolationCIELab InterpolationMode = "cielab"
+)
+
+// Easing shapes the interpolation factor between two stops
+type Easing string
+
+const (
+	// EasingSmoothstep eases in and out of each stop (the default)
+	EasingSmoothstep Easing = "smoothstep"
+	// EasingLinear changes the color at a constant rate
+	EasingLinear Easing = "linear"
+)
+
+// defaultGamma is the gamma of InterpolationGamma if none is set
+const defaultGamma = 2.2
+
+// Interpolation configures how GetColorFromPalette blends between the stops of a palette. The zero value
+// is the original behavior, gamma 2.2 blending with smoothstep easing.
+type Interpolation struct {
+	Mode   InterpolationMode `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Easing Easing            `json:"easing,omitempty" yaml:"easing,omitempty"`
+	// Gamma is the gamma of InterpolationGamma, 0 uses 2.2
+	Gamma float64 `json:"gamma,omitempty" yaml:"gamma,omitempty"`
+}
+
+// Validate returns an error for unknown modes and easings
+func (i Interpolation) Validate() error {
+	switch i.Mode {
+	case "", InterpolationGamma, InterpolationDiscrete, InterpolationRGB, InterpolationOKLab, InterpolationCIELab:
+	default:
+		return fmt.Errorf("unknown interpolation mode %q, expected gamma, discrete, rgb, oklab or cielab", i.Mode)
+	}
+
+	switch i.Easing {
+	case "", EasingSmoothstep, EasingLinear:
+	default:
+		return fmt.Errorf("unknown easing %q, expected smoothstep or linear", i.Easing)
+	}
+
+	if i.Gamma < 0 {
+		return fmt.Errorf("gamma must be positive")
+	}
+	return nil
+}
+
+// ease applies the easing to the interpolation factor (0 to 1)
+func (i Interpolation) ease(factor float32) float32 {
+	if i.Easing != EasingLinear {
+		// Smoothstep for smoother transitions
+		factor = factor * factor * (3 - 2*factor)
+	}
+	return float32(math.Max(0, math.Min(1, float64(factor))))
+}
+
+// blend interpolates between the colors in the color space of the mode, factor is between 0 and 1
+func (i Interpolation) blend(low, high Color, factor float32) Color {
+	switch i.Mode {
+	case InterpolationDiscrete:
+		return low
+	case InterpolationRGB:
+		return MixColors(low, high, float64(factor))
+	case InterpolationOKLab:
+		return blendInSpace(low, high, float64(factor), linearToOKLab, okLabToLinear)
+	case InterpolationCIELab:
+		return blendInSpace(low, high, float64(factor), linearToCIELab, cieLabToLinear)
+	default:
+		gamma := i.Gamma
+		if gamma == 0 {
+			gamma = defaultGamma
+		}
+		return blendGamma(low, high, factor, gamma)
+	}
+}
+
+// blendGamma interpolates each channel with gamma correction
+func blendGamma(low, high Color, factor float32, gamma float64) Color {
+	r := math.Pow(float64(factor)*math.Pow(float64(high.R)/255, gamma)+
+		(1-float64(factor))*math.Pow(float64(low.R)/255, gamma), 1/gamma) * 255
+	g := math.Pow(float64(factor)*math.Pow(float64(high.G)/255, gamma)+
+		(1-float64(factor))*math.Pow(float64(low.G)/255, gamma), 1/gamma) * 255
+	b := math.Pow(float64(factor)*math.Pow(float64(high.B)/255, gamma)+
+		(1-float64(factor))*math.Pow(float64(low.B)/255, gamma), 1/gamma) * 255
+	alpha := math.Pow(float64(factor)*math.Pow(float64(high.A)/255, gamma)+
+		(1-float64(factor))*math.Pow(float64(low.A)/255, gamma), 1/gamma) * 255
+
+	return Color{
+		R: clampChannel(r),
+		G: clampChannel(g),
+		B: clampChannel(b),
+		A: clampChannel(alpha),
+	}
+}
+
+// blendInSpace converts linear sRGB into a color space, interpolates there and converts back.
+// Alpha is interpolated linearly.
+func blendInSpace(low, high Color, factor float64, to, from func([3]float64) [3]float64) Color {
+	a, b := to(colorToLinear(low)), to(colorToLinear(high))
+
+	var mixed [3]float64
+	for i := range mixed {
+		mixed[i] = a[i]*(1-factor) + b[i]*factor
+	}
+
+	color := linearToColor(from(mixed))
+	color.A = clampChannel(float64(low.A)*(1-factor) + float64(high.A)*factor)
+	return color
+}
+
+func clampChannel(value float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, value))))
+}
+
+// srgbToLinear removes the sRGB transfer function of a channel (0 to 1)
+func srgbToLinear(value float64) float64 {
+	if value <= 0.04045 {
+		return value / 12.92
+	}
+	return math.Pow((value+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB applies the sRGB transfer function to a channel (0 to 1)
+func linearToSRGB(value float64) float64 {
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
+
+func colorToLinear(color Color) [3]float64 {
+	return [3]float64{
+		srgbToLinear(float64(color.R) / 255),
+		srgbToLinear(float64(color.G) / 255),
+		srgbToLinear(float64(color.B) / 255),
+	}
+}
+
+func linearToColor(rgb [3]float64) Color {
+	return Color{
+		R: clampChannel(linearToSRGB(math.Max(0, math.Min(1, rgb[0]))) * 255),
+		G: clampChannel(linearToSRGB(math.Max(0, math.Min(1, rgb[1]))) * 255),
+		B: clampChannel(linearToSRGB(math.Max(0, math.Min(1, rgb[2]))) * 255),
+	}
+}
+
+// linearToOKLab converts linear sRGB to OKLab (https://bottosson.github.io/posts/oklab/)
+func linearToOKLab(rgb [3]float64) [3]float64 {
+	l := math.Cbrt(0.4122214708*rgb[0] + 0.5363325363*rgb[1] + 0.0514459929*rgb[2])
+	m := math.Cbrt(0.2119034982*rgb[0] + 0.6806995451*rgb[1] + 0.1073969566*rgb[2])
+	s := math.Cbrt(0.0883024619*rgb[0] + 0.2817188376*rgb[1] + 0.6299787005*rgb[2])
+
+	return [3]float64{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// okLabToLinear converts OKLab to linear sRGB
+func okLabToLinear(lab [3]float64) [3]float64 {
+	l := lab[0] + 0.3963377774*lab[1] + 0.2158037573*lab[2]
+	m := lab[0] - 0.1055613458*lab[1] - 0.0638541728*lab[2]
+	s := lab[0] - 0.0894841775*lab[1] - 1.2914855480*lab[2]
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return [3]float64{
+		+4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s,
+	}
+}
+
+// D65 white point of CIELAB
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// linearToCIELab converts linear sRGB to CIELAB (D65)
+func linearToCIELab(rgb [3]float64) [3]float64 {
+	x := (0.4124564*rgb[0] + 0.3575761*rgb[1] + 0.1804375*rgb[2]) / whiteX
+	y := (0.2126729*rgb[0] + 0.7151522*rgb[1] + 0.0721750*rgb[2]) / whiteY
+	z := (0.0193339*rgb[0] + 0.1191920*rgb[1] + 0.9503041*rgb[2]) / whiteZ
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// cieLabToLinear converts CIELAB (D65) to linear sRGB
+func cieLabToLinear(lab [3]float64) [3]float64 {
+	fy := (lab[0] + 16) / 116
+	fx := fy + lab[1]/500
+	fz := fy - lab[2]/200
+
+	finv := func(t float64) float64 {
+		if t*t*t > 216.0/24389 {
+			return t * t * t
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	x, y, z := finv(fx)*whiteX, finv(fy)*whiteY, finv(fz)*whiteZ
+
+	return [3]float64{
+		3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z,
+	}
+}
@@ -23,4 +23,8 @@ type ColorStop struct {
 // ColorPalette represents a complete set of elevation-based colors
 type ColorPalette struct {
 	Stops []ColorStop
+	// Interpolation configures the blending between the stops, the zero value is gamma 2.2 with smoothstep
+	Interpolation Interpolation
+	// NoData is the color of missing values, if defined by an imported palette file
+	NoData *Color
 }
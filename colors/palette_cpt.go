@@ -0,0 +1,224 @@
+package colors
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseCPT parses a GMT color palette table. Each line is a "z0 color z1 color" segment, where colors are
+// written as "r g b", "r/g/b", gray values, names, "#rrggbb" or "h-s-v" (and h s v in HSV color model)
+// with an optional "@transparency" in percent. The N (NaN) color becomes the no-data color, the
+// background and foreground colors are ignored, as the palette continues its end colors.
+func ParseCPT(r io.Reader) (ColorPalette, error) {
+	var palette ColorPalette
+	hsv := false
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			if model, ok := strings.CutPrefix(strings.TrimSpace(line[1:]), "COLOR_MODEL"); ok {
+				model = strings.ToUpper(strings.Trim(model, " =\t+"))
+				hsv = model == "HSV"
+			}
+			continue
+		}
+
+		// Labels follow a semicolon
+		if index := strings.Index(line, ";"); index >= 0 {
+			line = line[:index]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "N":
+			color, err := parseCPTColor(fields[1:], hsv)
+			if err != nil {
+				return ColorPalette{}, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			palette.NoData = &color
+			continue
+		case "B", "F":
+			continue
+		}
+
+		// Drop the annotation flag
+		if last := fields[len(fields)-1]; last == "L" || last == "U" || last == "B" {
+			fields = fields[:len(fields)-1]
+		}
+
+		var lowFields, highFields []string
+		switch len(fields) {
+		case 4:
+			lowFields, highFields = fields[:2], fields[2:]
+		case 8:
+			lowFields, highFields = fields[:4], fields[4:]
+		default:
+			return ColorPalette{}, fmt.Errorf("line %d: expected \"z0 color z1 color\"", lineNumber)
+		}
+
+		for _, segmentFields := range [][]string{lowFields, highFields} {
+			elevation, err := strconv.ParseFloat(segmentFields[0], 32)
+			if err != nil {
+				return ColorPalette{}, fmt.Errorf("line %d: invalid elevation %q", lineNumber, segmentFields[0])
+			}
+			color, err := parseCPTColor(segmentFields[1:], hsv)
+			if err != nil {
+				return ColorPalette{}, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+
+			stop := ColorStop{Elevation: float32(elevation), Color: color}
+			if n := len(palette.Stops); n > 0 && palette.Stops[n-1] == stop {
+				continue
+			}
+			palette.Stops = append(palette.Stops, stop)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ColorPalette{}, err
+	}
+
+	if len(palette.Stops) == 0 {
+		return ColorPalette{}, fmt.Errorf("no color segments")
+	}
+	sortStops(palette.Stops)
+	return palette, nil
+}
+
+// parseCPTColor parses a color of a CPT line, given as one field or as three components
+func parseCPTColor(fields []string, hsv bool) (Color, error) {
+	if len(fields) == 0 {
+		return Color{}, fmt.Errorf("missing color")
+	}
+
+	// Transparency is appended to the last component
+	alpha := uint8(255)
+	last := fields[len(fields)-1]
+	if index := strings.Index(last, "@"); index >= 0 {
+		transparency, err := strconv.ParseFloat(last[index+1:], 64)
+		if err != nil || transparency < 0 || transparency > 100 {
+			return Color{}, fmt.Errorf("invalid transparency %q", last[index:])
+		}
+		alpha = uint8(math.Round(255 * (1 - transparency/100)))
+		fields = append(fields[:len(fields)-1:len(fields)-1], last[:index])
+	}
+
+	var components []string
+	switch {
+	case len(fields) == 3:
+		components = fields
+	case len(fields) != 1:
+		return Color{}, fmt.Errorf("invalid color %q", strings.Join(fields, " "))
+	case strings.Contains(fields[0], "/"):
+		components = strings.Split(fields[0], "/")
+	case strings.Count(fields[0], "-") == 2 && !strings.HasPrefix(fields[0], "-"):
+		components, hsv = strings.Split(fields[0], "-"), true
+	default:
+		if color, ok := parseNamedOrHexColor(fields[0]); ok {
+			color.A = alpha
+			return color, nil
+		}
+		// Gray value
+		components = []string{fields[0], fields[0], fields[0]}
+	}
+
+	if len(components) != 3 {
+		return Color{}, fmt.Errorf("invalid color %q", strings.Join(fields, " "))
+	}
+
+	var color Color
+	if hsv {
+		var values [3]float64
+		for i, component := range components {
+			value, err := strconv.ParseFloat(component, 64)
+			if err != nil {
+				return Color{}, fmt.Errorf("invalid HSV color %q", strings.Join(components, "-"))
+			}
+			values[i] = value
+		}
+		color = hsvToColor(values[0], values[1], values[2])
+	} else {
+		var err error
+		if color, err = parseRGBComponents(components); err != nil {
+			return Color{}, err
+		}
+	}
+
+	color.A = alpha
+	return color, nil
+}
+
+// hsvToColor converts a hue (0 to 360), saturation and value (0 to 1) to RGB
+func hsvToColor(h, s, v float64) Color {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 60
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	m := v - c
+	toByte := func(value float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, value+m)) * 255))
+	}
+	return Color{R: toByte(r), G: toByte(g), B: toByte(b), A: 255}
+}
+
+// formatCPTColor writes the color as "r/g/b" with the transparency if it isn't opaque
+func formatCPTColor(color Color) string {
+	value := fmt.Sprintf("%d/%d/%d", color.R, color.G, color.B)
+	if color.A != 255 {
+		value += fmt.Sprintf("@%g", math.Round((1-float64(color.A)/255)*1000)/10)
+	}
+	return value
+}
+
+// WriteCPT writes the palette as GMT color palette table, one segment between each pair of stops
+func WriteCPT(w io.Writer, palette ColorPalette) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintln(writer, "# COLOR_MODEL = RGB")
+
+	stops := palette.Stops
+	if len(stops) == 1 {
+		stops = []ColorStop{stops[0], stops[0]}
+	}
+	for i := 0; i+1 < len(stops); i++ {
+		low, high := stops[i], stops[i+1]
+		// Hard color changes are the start of the next segment
+		if low.Elevation == high.Elevation && len(stops) > 2 {
+			continue
+		}
+		fmt.Fprintf(writer, "%g\t%s\t%g\t%s\n", low.Elevation, formatCPTColor(low.Color), high.Elevation, formatCPTColor(high.Color))
+	}
+
+	if palette.NoData != nil {
+		fmt.Fprintf(writer, "N\t%s\n", formatCPTColor(*palette.NoData))
+	}
+	return writer.Flush()
+}
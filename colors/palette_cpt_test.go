@@ -0,0 +1,93 @@
+package colors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPT(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  ColorPalette
+	}{
+		{
+			name: "RGB",
+			input: `# Test palette
+# COLOR_MODEL = RGB
+-1000	0 0 255	0	0 128 255	; sea
+
+; land
+0	green	500	#ffff00@50	L
+500	128	1000	white	U
+B	black
+F	white
+N	128/128/128@100
+`,
+			want: ColorPalette{
+				Stops: []ColorStop{
+					{Elevation: -1000, Color: Color{R: 0, G: 0, B: 255, A: 255}},
+					{Elevation: 0, Color: Color{R: 0, G: 128, B: 255, A: 255}},
+					{Elevation: 0, Color: Color{R: 0, G: 255, B: 0, A: 255}},
+					{Elevation: 500, Color: Color{R: 255, G: 255, B: 0, A: 128}},
+					{Elevation: 500, Color: Color{R: 128, G: 128, B: 128, A: 255}},
+					{Elevation: 1000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+				},
+				NoData: &Color{R: 128, G: 128, B: 128, A: 0},
+			},
+		},
+		{
+			// Continuous segments share their boundary stop
+			name: "HSV",
+			input: `#COLOR_MODEL = +HSV
+0	0 1 1	100	120 1 0.5
+100	120-1-0.5	200	240-1-1@25	B
+`,
+			want: ColorPalette{Stops: []ColorStop{
+				{Elevation: 0, Color: Color{R: 255, G: 0, B: 0, A: 255}},
+				{Elevation: 100, Color: Color{R: 0, G: 128, B: 0, A: 255}},
+				{Elevation: 200, Color: Color{R: 0, G: 0, B: 255, A: 191}},
+			}},
+		},
+		{
+			name: "h-s-v colors in RGB model",
+			input: `0	60-1-1	10	300-0.5-1
+`,
+			want: ColorPalette{Stops: []ColorStop{
+				{Elevation: 0, Color: Color{R: 255, G: 255, B: 0, A: 255}},
+				{Elevation: 10, Color: Color{R: 255, G: 128, B: 255, A: 255}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			palette, err := ParseCPT(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(palette, test.want) {
+				t.Errorf("got %+v, want %+v", palette, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCPTErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"# only a comment\nB black\nF white",
+		"0 red 100",
+		"x red 100 blue",
+		"0 red 100 unknown",
+		"0 300/0/0 100 red",
+		"0 1/2 100 red",
+		"0 red@150 100 red",
+		"N",
+	} {
+		if _, err := ParseCPT(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: got no error", input)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package colors
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PaletteRange is the elevation range to which relative palette positions (GDAL percentages,
+// QGIS gradient stops) are mapped
+type PaletteRange struct {
+	Min float32 `json:"min" yaml:"min"`
+	Max float32 `json:"max" yaml:"max"`
+}
+
+// DefaultPaletteRange covers the elevations which can be expected on earth
+var DefaultPaletteRange = PaletteRange{Min: -12000, Max: 9000}
+
+// at returns the elevation at the relative position (0 to 1) of the range
+func (r PaletteRange) at(position float64) float32 {
+	return r.Min + float32(position)*(r.Max-r.Min)
+}
+
+// LoadPaletteFile reads a palette file, the format is detected by the extension: GMT (.cpt),
+// QGIS XML (.xml, .qml) or GDAL color-relief text (any other extension, e.g. .txt)
+func LoadPaletteFile(path string, valueRange PaletteRange) (ColorPalette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ColorPalette{}, err
+	}
+	defer file.Close()
+
+	var palette ColorPalette
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cpt":
+		palette, err = ParseCPT(file)
+	case ".xml", ".qml":
+		palette, err = ParseQGISColorRamp(file, valueRange)
+	default:
+		palette, err = ParseGDALColorRelief(file, valueRange)
+	}
+	if err != nil {
+		return ColorPalette{}, fmt.Errorf("failed to parse palette %s: %w", path, err)
+	}
+	return palette, nil
+}
+
+// PaletteFormat is a palette file format supported by WritePalette
+type PaletteFormat string
+
+const (
+	PaletteFormatGDAL PaletteFormat = "gdal"
+	PaletteFormatCPT  PaletteFormat = "cpt"
+	PaletteFormatQGIS PaletteFormat = "qgis"
+)
+
+// WritePalette exports the palette in the format, e.g. to document a theme or to render the same
+// colors with gdaldem, GMT or QGIS
+func WritePalette(w io.Writer, palette ColorPalette, format PaletteFormat) error {
+	switch format {
+	case PaletteFormatGDAL:
+		return WriteGDALColorRelief(w, palette)
+	case PaletteFormatCPT:
+		return WriteCPT(w, palette)
+	case PaletteFormatQGIS:
+		return WriteQGISColorRamp(w, palette)
+	default:
+		return fmt.Errorf("unknown palette format %q, expected gdal, cpt or qgis", format)
+	}
+}
+
+// sortStops orders the stops by elevation, keeping the file order of equal elevations (hard color changes)
+func sortStops(stops []ColorStop) {
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Elevation < stops[j].Elevation })
+}
+
+// namedColors are the color names understood by gdaldem and GMT
+var namedColors = map[string]Color{
+	"white":   {R: 255, G: 255, B: 255, A: 255},
+	"black":   {R: 0, G: 0, B: 0, A: 255},
+	"red":     {R: 255, G: 0, B: 0, A: 255},
+	"green":   {R: 0, G: 255, B: 0, A: 255},
+	"blue":    {R: 0, G: 0, B: 255, A: 255},
+	"yellow":  {R: 255, G: 255, B: 0, A: 255},
+	"magenta": {R: 255, G: 0, B: 255, A: 255},
+	"cyan":    {R: 0, G: 255, B: 255, A: 255},
+	"aqua":    {R: 0, G: 192, B: 192, A: 255},
+	"grey":    {R: 190, G: 190, B: 190, A: 255},
+	"gray":    {R: 190, G: 190, B: 190, A: 255},
+	"orange":  {R: 255, G: 127, B: 0, A: 255},
+	"brown":   {R: 165, G: 42, B: 42, A: 255},
+	"purple":  {R: 127, G: 0, B: 255, A: 255},
+	"violet":  {R: 127, G: 0, B: 255, A: 255},
+	"indigo":  {R: 75, G: 0, B: 130, A: 255},
+}
+
+// parseNamedOrHexColor parses a color name or a "#rrggbb" / "#rrggbbaa" value
+func parseNamedOrHexColor(value string) (Color, bool) {
+	if color, ok := namedColors[strings.ToLower(value)]; ok {
+		return color, true
+	}
+
+	if !strings.HasPrefix(value, "#") || (len(value) != 7 && len(value) != 9) {
+		return Color{}, false
+	}
+	bytes, err := hex.DecodeString(value[1:])
+	if err != nil {
+		return Color{}, false
+	}
+	color := Color{R: bytes[0], G: bytes[1], B: bytes[2], A: 255}
+	if len(bytes) == 4 {
+		color.A = bytes[3]
+	}
+	return color, true
+}
+
+// parseColorComponent parses a color channel value between 0 and 255
+func parseColorComponent(value string) (uint8, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 || number > 255 {
+		return 0, fmt.Errorf("invalid color component %q", value)
+	}
+	return uint8(number + 0.5), nil
+}
+
+// parseRGBComponents parses 3 or 4 color channels (red, green, blue and optional alpha)
+func parseRGBComponents(values []string) (Color, error) {
+	if len(values) != 3 && len(values) != 4 {
+		return Color{}, fmt.Errorf("expected 3 or 4 color components, got %d", len(values))
+	}
+
+	components := [4]uint8{0, 0, 0, 255}
+	for i, value := range values {
+		component, err := parseColorComponent(value)
+		if err != nil {
+			return Color{}, err
+		}
+		components[i] = component
+	}
+	return Color{R: components[0], G: components[1], B: components[2], A: components[3]}, nil
+}
@@ -0,0 +1,66 @@
+package colors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWritePaletteRoundTrip(t *testing.T) {
+	palette := ColorPalette{
+		Stops: []ColorStop{
+			{Elevation: -432.5, Color: Color{R: 0, G: 32, B: 128, A: 255}},
+			{Elevation: 0, Color: Color{R: 10, G: 120, B: 200, A: 128}},
+			{Elevation: 0, Color: Color{R: 40, G: 160, B: 60, A: 255}},
+			{Elevation: 1250.25, Color: Color{R: 200, G: 180, B: 100, A: 1}},
+			{Elevation: 8000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+		},
+		NoData: &Color{R: 12, G: 34, B: 56, A: 0},
+	}
+	discrete := palette
+	discrete.Interpolation.Mode = InterpolationDiscrete
+
+	tests := []struct {
+		name      string
+		format    PaletteFormat
+		extension string
+		palette   ColorPalette
+		want      ColorPalette
+	}{
+		{"gdal", PaletteFormatGDAL, ".txt", palette, palette},
+		{"cpt", PaletteFormatCPT, ".cpt", palette, palette},
+		// QGIS styles have no no-data color
+		{"qgis", PaletteFormatQGIS, ".qml", palette, ColorPalette{Stops: palette.Stops}},
+		{"qgis discrete", PaletteFormatQGIS, ".qml", discrete, ColorPalette{Stops: palette.Stops, Interpolation: discrete.Interpolation}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WritePalette(&buf, test.palette, test.format); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "palette"+test.extension)
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := LoadPaletteFile(path, DefaultPaletteRange)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(parsed, test.want) {
+				t.Errorf("got %+v, want %+v\n%s", parsed, test.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestWritePaletteUnknownFormat(t *testing.T) {
+	palette := ColorPalette{Stops: []ColorStop{{Elevation: 0, Color: Color{A: 255}}}}
+	if err := WritePalette(&bytes.Buffer{}, palette, "svg"); err == nil {
+		t.Errorf("got no error for an unknown format")
+	}
+}
@@ -0,0 +1,105 @@
+package colors
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseGDALColorRelief parses a gdaldem color-relief configuration: one "elevation R G B [A]" or
+// "elevation colorname" entry per line, separated by spaces, tabs, commas or colons. The elevation can
+// be "nv" (the no-data color) or a percentage, which is mapped to the value range. Comments (#) and the
+// INTERPOLATION header of QGIS color map exports are skipped.
+func ParseGDALColorRelief(r io.Reader, valueRange PaletteRange) (ColorPalette, error) {
+	var palette ColorPalette
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(strings.ToUpper(line), "INTERPOLATION") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ',' || r == ':'
+		})
+		if len(fields) < 2 {
+			return ColorPalette{}, fmt.Errorf("line %d: expected elevation and color", lineNumber)
+		}
+
+		color, err := parseGDALColor(fields[1:])
+		if err != nil {
+			return ColorPalette{}, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		value := strings.ToLower(fields[0])
+		if value == "nv" {
+			palette.NoData = &color
+			continue
+		}
+
+		var elevation float32
+		if percentage, ok := strings.CutSuffix(value, "%"); ok {
+			number, err := strconv.ParseFloat(percentage, 64)
+			if err != nil {
+				return ColorPalette{}, fmt.Errorf("line %d: invalid percentage %q", lineNumber, fields[0])
+			}
+			elevation = valueRange.at(number / 100)
+		} else {
+			number, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return ColorPalette{}, fmt.Errorf("line %d: invalid elevation %q", lineNumber, fields[0])
+			}
+			elevation = float32(number)
+		}
+
+		palette.Stops = append(palette.Stops, ColorStop{Elevation: elevation, Color: color})
+	}
+	if err := scanner.Err(); err != nil {
+		return ColorPalette{}, err
+	}
+
+	if len(palette.Stops) == 0 {
+		return ColorPalette{}, fmt.Errorf("no color entries")
+	}
+	sortStops(palette.Stops)
+	return palette, nil
+}
+
+// parseGDALColor parses a color name or the R G B [A] components, trailing labels are ignored. Like gdaldem,
+// a numeric 4th field is always the alpha value, so a numeric label directly after R G B is read as alpha
+// (or rejected above 255). QGIS color map exports always write the alpha value before the label.
+func parseGDALColor(fields []string) (Color, error) {
+	if color, ok := parseNamedOrHexColor(fields[0]); ok {
+		return color, nil
+	}
+
+	// Only take the numeric components, QGIS exports add a label after the alpha value
+	components := fields[:0:0]
+	for _, field := range fields {
+		if _, err := strconv.ParseFloat(field, 64); err != nil || len(components) == 4 {
+			break
+		}
+		components = append(components, field)
+	}
+	if len(components) < 3 {
+		return Color{}, fmt.Errorf("invalid color %q", strings.Join(fields, " "))
+	}
+	return parseRGBComponents(components)
+}
+
+// WriteGDALColorRelief writes the palette as gdaldem color-relief configuration
+func WriteGDALColorRelief(w io.Writer, palette ColorPalette) error {
+	writer := bufio.NewWriter(w)
+	for _, stop := range palette.Stops {
+		fmt.Fprintf(writer, "%g %d %d %d %d\n", stop.Elevation, stop.Color.R, stop.Color.G, stop.Color.B, stop.Color.A)
+	}
+	if palette.NoData != nil {
+		fmt.Fprintf(writer, "nv %d %d %d %d\n", palette.NoData.R, palette.NoData.G, palette.NoData.B, palette.NoData.A)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,102 @@
+package colors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGDALColorRelief(t *testing.T) {
+	input := `# gdaldem color-relief
+nv 0 0 0 0
+100% white
+50%	200	200	200
+0 #10a020
+-500,0,0,255,128
+1000:120:80:40
+`
+	palette, err := ParseGDALColorRelief(strings.NewReader(input), PaletteRange{Min: -1000, Max: 3000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ColorPalette{
+		Stops: []ColorStop{
+			{Elevation: -500, Color: Color{R: 0, G: 0, B: 255, A: 128}},
+			{Elevation: 0, Color: Color{R: 16, G: 160, B: 32, A: 255}},
+			{Elevation: 1000, Color: Color{R: 200, G: 200, B: 200, A: 255}},
+			{Elevation: 1000, Color: Color{R: 120, G: 80, B: 40, A: 255}},
+			{Elevation: 3000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+		},
+		NoData: &Color{},
+	}
+	if !reflect.DeepEqual(palette, want) {
+		t.Errorf("got %+v, want %+v", palette, want)
+	}
+}
+
+func TestParseGDALColorReliefQGISExport(t *testing.T) {
+	// QGIS color map exports have a header and a label after the alpha value, which can be numeric
+	input := `# QGIS Generated Color Map Export File
+INTERPOLATION:INTERPOLATED
+-100,215,25,28,255,-100
+0,255,255,191,200,0 m
+500,26,150,65,255,Label 500
+`
+	palette, err := ParseGDALColorRelief(strings.NewReader(input), DefaultPaletteRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ColorStop{
+		{Elevation: -100, Color: Color{R: 215, G: 25, B: 28, A: 255}},
+		{Elevation: 0, Color: Color{R: 255, G: 255, B: 191, A: 200}},
+		{Elevation: 500, Color: Color{R: 26, G: 150, B: 65, A: 255}},
+	}
+	if !reflect.DeepEqual(palette.Stops, want) {
+		t.Errorf("got %+v, want %+v", palette.Stops, want)
+	}
+}
+
+func TestParseGDALColorLabels(t *testing.T) {
+	tests := []struct {
+		line  string
+		color Color
+		err   bool
+	}{
+		{"10 20 30", Color{R: 10, G: 20, B: 30, A: 255}, false},
+		{"10 20 30 label", Color{R: 10, G: 20, B: 30, A: 255}, false},
+		{"10 20 30 40 label", Color{R: 10, G: 20, B: 30, A: 40}, false},
+		{"10 20 30 40 500", Color{R: 10, G: 20, B: 30, A: 40}, false},
+		// A numeric label directly after the RGB components is the alpha value, like gdaldem reads it
+		{"10 20 30 100", Color{R: 10, G: 20, B: 30, A: 100}, false},
+		{"10 20 30 1000", Color{}, true},
+		{"red label", Color{R: 255, A: 255}, false},
+		{"10 20", Color{}, true},
+	}
+
+	for _, test := range tests {
+		color, err := parseGDALColor(strings.Fields(test.line))
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, want error %v", test.line, err, test.err)
+		} else if color != test.color {
+			t.Errorf("%q: got %+v, want %+v", test.line, color, test.color)
+		}
+	}
+}
+
+func TestParseGDALColorReliefErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"# only a comment",
+		"100",
+		"abc 10 20 30",
+		"x% 10 20 30",
+		"100 300 20 30",
+		"100 unknown",
+	} {
+		if _, err := ParseGDALColorRelief(strings.NewReader(input), DefaultPaletteRange); err == nil {
+			t.Errorf("%q: got no error", input)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package colors
+
+import (
+	"math"
+	"sync"
+)
+
+// lutStepsPerMeter is the resolution of the palette lookup tables (decimeters)
+const lutStepsPerMeter = 10
+
+// lutMaxEntries limits the memory of a lookup table (~20 MB), palettes spanning more use GetColorFromPalette
+const lutMaxEntries = 1 << 22
+
+// PaletteLUT is a palette compiled into a lookup table of decimeter buckets between the first and last stop,
+// returning exactly the colors of GetColorFromPalette. Buckets in which the color doesn't change are looked up,
+// the others (e.g. with a stop inside or where a channel steps to the next value) are calculated. The table is
+// built on first use.
+type PaletteLUT struct {
+	palette ColorPalette
+
+	once    sync.Once
+	min     float32
+	entries []lutEntry
+}
+
+// lutEntry is a bucket of the lookup table, uniform if all elevations of the bucket have the color
+type lutEntry struct {
+	color   Color
+	uniform bool
+}
+
+// NewPaletteLUT creates the lookup table of the palette
+func NewPaletteLUT(palette ColorPalette) *PaletteLUT {
+	return &PaletteLUT{palette: palette}
+}
+
+// Palette returns the palette of the lookup table
+func (l *PaletteLUT) Palette() ColorPalette {
+	return l.palette
+}
+
+// bucketStart returns the lowest elevation of the bucket
+func (l *PaletteLUT) bucketStart(index int) float32 {
+	return float32(float64(l.min) + float64(index)/lutStepsPerMeter)
+}
+
+func (l *PaletteLUT) build() {
+	// A single stop colors all elevations, Color returns it without a table
+	stops := l.palette.Stops
+	if len(stops) < 2 {
+		return
+	}
+
+	l.min = stops[0].Elevation
+	span := float64(stops[len(stops)-1].Elevation - l.min)
+
+	if math.IsInf(span, 0) || math.IsNaN(span) || span*lutStepsPerMeter >= lutMaxEntries {
+		return
+	}
+
+	// The colors of the blendings in other color spaces can change back and forth within a bucket, so an
+	// equal color at both ends doesn't mean it's the same in between
+	switch l.palette.Interpolation.Mode {
+	case "", InterpolationGamma, InterpolationDiscrete, InterpolationRGB:
+	default:
+		return
+	}
+
+	count := int(math.Ceil(span*lutStepsPerMeter)) + 1
+	l.entries = make([]lutEntry, count)
+
+	// The channels change monotonically between two stops, so a bucket without a stop inside has a single
+	// color if its first and last elevation have the same color
+	stop := 1
+	for i := range l.entries {
+		first := l.bucketStart(i)
+		last := math.Nextafter32(l.bucketStart(i+1), float32(math.Inf(-1)))
+		for stop < len(stops)-1 && stops[stop].Elevation <= first {
+			stop++
+		}
+		if last < first || stops[stop].Elevation <= last {
+			continue
+		}
+
+		color := GetColorFromPalette(first, l.palette)
+		l.entries[i] = lutEntry{color: color, uniform: color == GetColorFromPalette(last, l.palette)}
+	}
+}
+
+// Color returns the color of the elevation, exactly like GetColorFromPalette
+func (l *PaletteLUT) Color(elevation float32) Color {
+	l.once.Do(l.build)
+
+	stops := l.palette.Stops
+	if elevation <= stops[0].Elevation {
+		return stops[0].Color
+	}
+	if elevation >= stops[len(stops)-1].Elevation {
+		return stops[len(stops)-1].Color
+	}
+	if l.entries == nil || elevation != elevation {
+		return GetColorFromPalette(elevation, l.palette)
+	}
+
+	// The bucket of the elevation, corrected where the rounding of the index differs from the bucket limits
+	index := min(max(int((float64(elevation)-float64(l.min))*lutStepsPerMeter), 0), len(l.entries)-1)
+	if elevation < l.bucketStart(index) {
+		index--
+	} else if index+1 < len(l.entries) && elevation >= l.bucketStart(index+1) {
+		index++
+	}
+
+	if entry := l.entries[index]; entry.uniform {
+		return entry.color
+	}
+	return GetColorFromPalette(elevation, l.palette)
+}
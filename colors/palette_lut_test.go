@@ -0,0 +1,115 @@
+package colors
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testPalette has stops between whole decimeters, a hard color change (two stops at the same elevation) and
+// stops with equal colors
+func testPalette(interpolation Interpolation) ColorPalette {
+	return ColorPalette{
+		Stops: []ColorStop{
+			{Elevation: -11000, Color: Color{R: 8, G: 29, B: 88, A: 255}},
+			{Elevation: -2500, Color: Color{R: 69, G: 121, B: 180, A: 255}},
+			{Elevation: -50.25, Color: Color{R: 200, G: 234, B: 255, A: 255}},
+			{Elevation: 0, Color: Color{R: 216, G: 242, B: 254, A: 255}},
+			{Elevation: 0, Color: Color{R: 172, G: 208, B: 165, A: 255}},
+			{Elevation: 12.34, Color: Color{R: 148, G: 191, B: 139, A: 255}},
+			{Elevation: 250, Color: Color{R: 148, G: 191, B: 139, A: 200}},
+			{Elevation: 1250.05, Color: Color{R: 239, G: 235, B: 192, A: 255}},
+			{Elevation: 3000, Color: Color{R: 192, G: 154, B: 83, A: 255}},
+			{Elevation: 9000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+		},
+		Interpolation: interpolation,
+	}
+}
+
+var testInterpolations = []Interpolation{
+	{},
+	{Mode: InterpolationGamma, Easing: EasingLinear, Gamma: 1.8},
+	{Mode: InterpolationDiscrete},
+	{Mode: InterpolationRGB},
+	{Mode: InterpolationRGB, Easing: EasingLinear},
+	{Mode: InterpolationOKLab},
+	{Mode: InterpolationCIELab, Easing: EasingLinear},
+}
+
+func TestPaletteLUTMatchesGetColorFromPalette(t *testing.T) {
+	for _, interpolation := range testInterpolations {
+		t.Run(fmt.Sprintf("%s-%s", interpolation.Mode, interpolation.Easing), func(t *testing.T) {
+			// The colors blended in other color spaces are calculated directly, so a coarser step suffices
+			step := 0.02
+			if interpolation.Mode == InterpolationOKLab || interpolation.Mode == InterpolationCIELab {
+				step = 0.5
+			}
+			if testing.Short() {
+				step = 0.37
+			}
+
+			palette := testPalette(interpolation)
+			lut := NewPaletteLUT(palette)
+
+			check := func(elevation float32) {
+				if got, want := lut.Color(elevation), GetColorFromPalette(elevation, palette); got != want {
+					t.Fatalf("elevation %v: got %v, want %v", elevation, got, want)
+				}
+			}
+
+			// The full elevation range of the palette and beyond
+			for elevation := -11100.0; elevation <= 9100; elevation += step {
+				check(float32(elevation))
+			}
+
+			// Around the stops and the bucket limits next to them
+			for _, stop := range palette.Stops {
+				for _, offset := range []float32{-0.1, 0, 0.1} {
+					elevation := stop.Elevation + offset
+					check(elevation)
+					check(math.Nextafter32(elevation, float32(math.Inf(-1))))
+					check(math.Nextafter32(elevation, float32(math.Inf(1))))
+				}
+			}
+
+			check(float32(math.NaN()))
+			check(float32(math.Inf(1)))
+			check(float32(math.Inf(-1)))
+		})
+	}
+}
+
+func TestPaletteLUTSingleStop(t *testing.T) {
+	// Palette files and themes with a single entry color all elevations
+	palette, err := ParseGDALColorRelief(strings.NewReader("100 red"), DefaultPaletteRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, interpolation := range testInterpolations {
+		palette.Interpolation = interpolation
+		lut := NewPaletteLUT(palette)
+		for _, elevation := range []float32{-5, 100, 5000, float32(math.Inf(1))} {
+			if color := lut.Color(elevation); color != palette.Stops[0].Color {
+				t.Errorf("%s: elevation %v: got %v, want the color of the stop", interpolation.Mode, elevation, color)
+			}
+		}
+	}
+}
+
+func BenchmarkGetColorFromPalette(b *testing.B) {
+	palette := testPalette(Interpolation{})
+	for i := 0; i < b.N; i++ {
+		GetColorFromPalette(float32(i%20000-11000)+0.25, palette)
+	}
+}
+
+func BenchmarkPaletteLUT(b *testing.B) {
+	lut := NewPaletteLUT(testPalette(Interpolation{}))
+	lut.Color(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lut.Color(float32(i%20000-11000) + 0.25)
+	}
+}
@@ -0,0 +1,214 @@
+package colors
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// qgisStopPattern matches a "position;r,g,b,a" gradient stop, newer QGIS versions append more color specs
+var qgisStopPattern = regexp.MustCompile(`([0-9.eE+-]+);(\d+),(\d+),(\d+),(\d+)`)
+
+// ParseQGISColorRamp parses a QGIS XML export. Raster styles (.qml) with color ramp shader items have
+// absolute values (discrete and exact ramps use the discrete interpolation), the gradient of a style
+// export (first colorramp element, QGIS 2 props or QGIS 3 options) has relative stops, which are mapped
+// to the value range.
+func ParseQGISColorRamp(r io.Reader, valueRange PaletteRange) (ColorPalette, error) {
+	decoder := xml.NewDecoder(r)
+
+	var palette ColorPalette
+	rampType := ""
+	ramp := map[string]string{}
+	inRamp, rampDone := false, false
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ColorPalette{}, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			attributes := make(map[string]string, len(element.Attr))
+			for _, attribute := range element.Attr {
+				attributes[attribute.Name.Local] = attribute.Value
+			}
+
+			switch element.Name.Local {
+			case "colorrampshader":
+				rampType = strings.ToUpper(attributes["colorRampType"])
+			case "paletteEntry":
+				rampType = "EXACT"
+				fallthrough
+			case "item":
+				stop, err := parseQGISItem(attributes)
+				if err != nil {
+					return ColorPalette{}, err
+				}
+				palette.Stops = append(palette.Stops, stop)
+			case "colorramp":
+				inRamp = !rampDone
+			case "prop":
+				if inRamp {
+					ramp[attributes["k"]] = attributes["v"]
+				}
+			case "Option":
+				if inRamp && attributes["name"] != "" {
+					ramp[attributes["name"]] = attributes["value"]
+				}
+			}
+		case xml.EndElement:
+			if element.Name.Local == "colorramp" && inRamp {
+				inRamp, rampDone = false, true
+			}
+		}
+	}
+
+	if len(palette.Stops) > 0 {
+		sortStops(palette.Stops)
+		switch rampType {
+		case "DISCRETE":
+			// QGIS uses the color of an item up to its value, the discrete interpolation from the value on
+			discrete := []ColorStop{palette.Stops[0]}
+			for i := 1; i < len(palette.Stops); i++ {
+				stop := ColorStop{Elevation: palette.Stops[i-1].Elevation, Color: palette.Stops[i].Color}
+				if stop != discrete[len(discrete)-1] {
+					discrete = append(discrete, stop)
+				}
+			}
+			palette.Stops = discrete
+			palette.Interpolation.Mode = InterpolationDiscrete
+		case "EXACT":
+			palette.Interpolation.Mode = InterpolationDiscrete
+		}
+		return palette, nil
+	}
+	if !rampDone {
+		return ColorPalette{}, fmt.Errorf("no color ramp or color ramp shader items found")
+	}
+	return parseQGISGradient(ramp, valueRange)
+}
+
+// parseQGISItem parses a color ramp shader item with value, color and alpha attributes
+func parseQGISItem(attributes map[string]string) (ColorStop, error) {
+	value, err := strconv.ParseFloat(attributes["value"], 32)
+	if err != nil {
+		return ColorStop{}, fmt.Errorf("invalid item value %q", attributes["value"])
+	}
+
+	color, ok := parseNamedOrHexColor(attributes["color"])
+	if !ok {
+		return ColorStop{}, fmt.Errorf("invalid item color %q", attributes["color"])
+	}
+	if alpha, found := attributes["alpha"]; found {
+		if color.A, err = parseColorComponent(alpha); err != nil {
+			return ColorStop{}, err
+		}
+	}
+
+	return ColorStop{Elevation: float32(value), Color: color}, nil
+}
+
+// parseQGISColor parses a "r,g,b,a" color, ignoring the color specs appended by newer QGIS versions
+func parseQGISColor(value string) (Color, error) {
+	components := strings.Split(value, ",")
+	if len(components) < 3 {
+		return Color{}, fmt.Errorf("invalid color %q", value)
+	}
+	return parseRGBComponents(components[:min(len(components), 4)])
+}
+
+// parseQGISGradient converts the properties of a gradient color ramp
+func parseQGISGradient(ramp map[string]string, valueRange PaletteRange) (ColorPalette, error) {
+	if rampType, ok := ramp["rampType"]; ok && rampType != "gradient" {
+		return ColorPalette{}, fmt.Errorf("unsupported color ramp type %q", rampType)
+	}
+
+	color1, err := parseQGISColor(ramp["color1"])
+	if err != nil {
+		return ColorPalette{}, fmt.Errorf("color1: %w", err)
+	}
+	color2, err := parseQGISColor(ramp["color2"])
+	if err != nil {
+		return ColorPalette{}, fmt.Errorf("color2: %w", err)
+	}
+
+	stops := []ColorStop{{Elevation: valueRange.at(0), Color: color1}}
+	for _, match := range qgisStopPattern.FindAllStringSubmatch(ramp["stops"], -1) {
+		position, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return ColorPalette{}, fmt.Errorf("invalid stop position %q", match[1])
+		}
+		color, err := parseRGBComponents(match[2:6])
+		if err != nil {
+			return ColorPalette{}, err
+		}
+		stops = append(stops, ColorStop{Elevation: valueRange.at(position), Color: color})
+	}
+	stops = append(stops, ColorStop{Elevation: valueRange.at(1), Color: color2})
+	sortStops(stops)
+
+	// Discrete ramps keep the color of a stop until the next one
+	if ramp["discrete"] == "1" {
+		discrete := make([]ColorStop, 0, 2*len(stops))
+		for i, stop := range stops {
+			if i > 0 {
+				discrete = append(discrete, ColorStop{Elevation: stop.Elevation, Color: stops[i-1].Color})
+			}
+			discrete = append(discrete, stop)
+		}
+		stops = discrete
+	}
+
+	return ColorPalette{Stops: stops}, nil
+}
+
+// WriteQGISColorRamp writes the palette as QGIS raster style (.qml) with an interpolated color ramp shader,
+// or a discrete one for palettes with discrete interpolation
+func WriteQGISColorRamp(w io.Writer, palette ColorPalette) error {
+	if len(palette.Stops) == 0 {
+		return fmt.Errorf("palette has no color stops")
+	}
+
+	rampType, items := "INTERPOLATED", palette.Stops
+	if palette.Interpolation.Mode == InterpolationDiscrete {
+		// QGIS uses the color of an item up to its value
+		rampType, items = "DISCRETE", []ColorStop{palette.Stops[0]}
+		for i := 0; i < len(palette.Stops)-1; i++ {
+			items = append(items, ColorStop{Elevation: palette.Stops[i+1].Elevation, Color: palette.Stops[i].Color})
+		}
+		items = append(items, ColorStop{Elevation: float32(math.Inf(1)), Color: palette.Stops[len(palette.Stops)-1].Color})
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.WriteString("<!DOCTYPE qgis PUBLIC 'http://mrcc.com/qgis.dtd' 'SYSTEM'>\n")
+	writer.WriteString("<qgis styleCategories=\"Symbology\">\n")
+	writer.WriteString("  <pipe>\n")
+	writer.WriteString("    <rasterrenderer type=\"singlebandpseudocolor\" band=\"1\" opacity=\"1\">\n")
+	writer.WriteString("      <rastershader>\n")
+	fmt.Fprintf(writer, "        <colorrampshader colorRampType=\"%s\" minimumValue=\"%g\" maximumValue=\"%g\">\n",
+		rampType, palette.Stops[0].Elevation, palette.Stops[len(palette.Stops)-1].Elevation)
+	for _, stop := range items {
+		value := strconv.FormatFloat(float64(stop.Elevation), 'g', -1, 32)
+		if math.IsInf(float64(stop.Elevation), 1) {
+			value = "inf"
+		}
+		fmt.Fprintf(writer, "          <item value=\"%s\" color=\"#%02x%02x%02x\" alpha=\"%d\" label=\"%s\"/>\n",
+			value, stop.Color.R, stop.Color.G, stop.Color.B, stop.Color.A, value)
+	}
+	writer.WriteString("        </colorrampshader>\n")
+	writer.WriteString("      </rastershader>\n")
+	writer.WriteString("    </rasterrenderer>\n")
+	writer.WriteString("  </pipe>\n")
+	writer.WriteString("</qgis>\n")
+	return writer.Flush()
+}
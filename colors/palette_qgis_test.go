@@ -0,0 +1,136 @@
+package colors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQGISColorRamp(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		valueRange PaletteRange
+		want       ColorPalette
+	}{
+		{
+			name: "interpolated items",
+			input: `<qgis><pipe><rasterrenderer><rastershader>
+<colorrampshader colorRampType="INTERPOLATED">
+  <item value="1000" color="#ffffff" alpha="255" label="1000"/>
+  <item value="-50.5" color="#0000ff" alpha="128" label="sea"/>
+  <item value="0" color="#00ff00" label="0"/>
+</colorrampshader>
+</rastershader></rasterrenderer></pipe></qgis>`,
+			want: ColorPalette{Stops: []ColorStop{
+				{Elevation: -50.5, Color: Color{R: 0, G: 0, B: 255, A: 128}},
+				{Elevation: 0, Color: Color{R: 0, G: 255, B: 0, A: 255}},
+				{Elevation: 1000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+			}},
+		},
+		{
+			// QGIS uses the color of an item up to its value
+			name: "discrete items",
+			input: `<qgis><colorrampshader colorRampType="DISCRETE">
+  <item value="0" color="#ff0000" alpha="255"/>
+  <item value="100" color="#00ff00" alpha="255"/>
+  <item value="inf" color="#0000ff" alpha="255"/>
+</colorrampshader></qgis>`,
+			want: ColorPalette{
+				Stops: []ColorStop{
+					{Elevation: 0, Color: Color{R: 255, G: 0, B: 0, A: 255}},
+					{Elevation: 0, Color: Color{R: 0, G: 255, B: 0, A: 255}},
+					{Elevation: 100, Color: Color{R: 0, G: 0, B: 255, A: 255}},
+				},
+				Interpolation: Interpolation{Mode: InterpolationDiscrete},
+			},
+		},
+		{
+			name: "palette entries",
+			input: `<qgis><rasterrenderer type="paletted"><colorPalette>
+  <paletteEntry value="2" color="#00ff00" alpha="255" label="forest"/>
+  <paletteEntry value="1" color="#ff0000" alpha="200" label="urban"/>
+</colorPalette></rasterrenderer></qgis>`,
+			want: ColorPalette{
+				Stops: []ColorStop{
+					{Elevation: 1, Color: Color{R: 255, G: 0, B: 0, A: 200}},
+					{Elevation: 2, Color: Color{R: 0, G: 255, B: 0, A: 255}},
+				},
+				Interpolation: Interpolation{Mode: InterpolationDiscrete},
+			},
+		},
+		{
+			name: "QGIS 2 gradient",
+			input: `<qgis_style version="1"><colorramps>
+<colorramp type="gradient" name="terrain">
+  <prop k="color1" v="0,0,0,255"/>
+  <prop k="color2" v="255,255,255,255"/>
+  <prop k="discrete" v="0"/>
+  <prop k="stops" v="0.5;255,0,0,255"/>
+</colorramp>
+<colorramp type="gradient" name="other">
+  <prop k="color1" v="1,2,3,255"/>
+</colorramp>
+</colorramps></qgis_style>`,
+			valueRange: PaletteRange{Min: 0, Max: 1000},
+			want: ColorPalette{Stops: []ColorStop{
+				{Elevation: 0, Color: Color{R: 0, G: 0, B: 0, A: 255}},
+				{Elevation: 500, Color: Color{R: 255, G: 0, B: 0, A: 255}},
+				{Elevation: 1000, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+			}},
+		},
+		{
+			name: "QGIS 3 discrete gradient",
+			input: `<qgis_style version="2"><colorramps>
+<colorramp type="gradient" name="bands">
+  <Option type="Map">
+    <Option name="color1" type="QString" value="0,0,255,255,rgb:0,0,1,1"/>
+    <Option name="color2" type="QString" value="255,255,255,255,rgb:1,1,1,1"/>
+    <Option name="discrete" type="QString" value="1"/>
+    <Option name="rampType" type="QString" value="gradient"/>
+    <Option name="stops" type="QString" value="0.25;0,255,0,128,rgb:0,1,0,0.5:0.75;255,0,0,255,rgb:1,0,0,1"/>
+  </Option>
+</colorramp>
+</colorramps></qgis_style>`,
+			valueRange: PaletteRange{Min: -100, Max: 300},
+			want: ColorPalette{Stops: []ColorStop{
+				{Elevation: -100, Color: Color{R: 0, G: 0, B: 255, A: 255}},
+				{Elevation: 0, Color: Color{R: 0, G: 0, B: 255, A: 255}},
+				{Elevation: 0, Color: Color{R: 0, G: 255, B: 0, A: 128}},
+				{Elevation: 200, Color: Color{R: 0, G: 255, B: 0, A: 128}},
+				{Elevation: 200, Color: Color{R: 255, G: 0, B: 0, A: 255}},
+				{Elevation: 300, Color: Color{R: 255, G: 0, B: 0, A: 255}},
+				{Elevation: 300, Color: Color{R: 255, G: 255, B: 255, A: 255}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			palette, err := ParseQGISColorRamp(strings.NewReader(test.input), test.valueRange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(palette, test.want) {
+				t.Errorf("got %+v, want %+v", palette, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQGISColorRampErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"<qgis></qgis>",
+		`<qgis><item value="x" color="#ffffff"/></qgis>`,
+		`<qgis><item value="1" color="white-ish"/></qgis>`,
+		`<qgis><item value="1" color="#ffffff" alpha="300"/></qgis>`,
+		`<colorramp type="random"><prop k="rampType" v="random"/></colorramp>`,
+		`<colorramp type="gradient"><prop k="color1" v="0,0"/><prop k="color2" v="0,0,0,255"/></colorramp>`,
+		"<qgis><item",
+	} {
+		if _, err := ParseQGISColorRamp(strings.NewReader(input), DefaultPaletteRange); err == nil {
+			t.Errorf("%q: got no error", input)
+		}
+	}
+}
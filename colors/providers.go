@@ -2,6 +2,7 @@ package colors
 
 import (
 	"context"
+	"fmt"
 	"image"
 	"io"
 )
@@ -19,6 +20,12 @@ type DataCell interface {
 	PolarFactor() float64
 	// AquatorFactor is a value between 0 and 1, where 1 is aquator and 0 is polar
 	AquatorFactor() float64
+	// Slope is the steepness of the terrain in degrees (0 is flat, 90 is vertical)
+	Slope() float64
+	// Aspect is the compass direction the slope faces in degrees clockwise from north, -1 if flat
+	Aspect() float64
+	// Curvature is the curvature of the terrain in 1/100 m, positive for ridges, negative for valleys
+	Curvature() float64
 }
 
 // ColorInput is the input for the GetColor handler
@@ -26,6 +33,45 @@ type ColorInput struct {
 	Zoom uint32
 	// DataMap is a 2D slice of DataCell where each element is a cell
 	DataMap [][]DataCell
+	// Hillshade is the illumination of each cell (0 dark to 1 fully lit), only set for providers
+	// implementing HillshadeProvider
+	Hillshade [][]float32
+}
+
+// HillshadeOptions configures the hillshade computation of a provider
+type HillshadeOptions struct {
+	// Method is the slope kernel, "horn" (default) or "zevenbergen-thorne"
+	Method string
+	// Azimuth is the direction of the sun in degrees clockwise from north
+	Azimuth float64
+	// Altitude is the angle of the sun above the horizon in degrees
+	Altitude float64
+	// ZFactor exaggerates the elevation
+	ZFactor float64
+	// Strength is the opacity of the shading when blended into colors (0 to 1)
+	Strength float64
+}
+
+// DefaultHillshadeOptions returns the classic cartographic lighting from the north-west
+func DefaultHillshadeOptions() HillshadeOptions {
+	return HillshadeOptions{
+		Method:   "horn",
+		Azimuth:  315,
+		Altitude: 45,
+		ZFactor:  1,
+		Strength: 0.6,
+	}
+}
+
+// String identifies the options (e.g. as part of a provider version)
+func (o HillshadeOptions) String() string {
+	return fmt.Sprintf("%s-%g-%g-%g-%g", o.Method, o.Azimuth, o.Altitude, o.ZFactor, o.Strength)
+}
+
+// HillshadeProvider is implemented by providers which need the hillshade of the tile
+type HillshadeProvider interface {
+	// HillshadeOptions returns the lighting of the hillshade, nil if none is needed
+	HillshadeOptions() *HillshadeOptions
 }
 
 // ColorProvider is the interface for to handle color generation
@@ -41,3 +87,17 @@ type ColorProvider interface {
 	// EncodeImage encodes the final image (e.g. to PNG or else) and returns the file type or error
 	EncodeImage(w io.Writer, img image.Image) error
 }
+
+// VersionedProvider can be implemented by a ColorProvider to invalidate cached tiles when its output changes
+type VersionedProvider interface {
+	// Version identifies the output of the provider (e.g. "2"), changing it invalidates the cached tiles
+	Version() string
+}
+
+// ProviderVersion returns the version of the provider, or "0" if it is not versioned
+func ProviderVersion(provider ColorProvider) string {
+	if versioned, ok := provider.(VersionedProvider); ok {
+		return versioned.Version()
+	}
+	return "0"
+}
@@ -0,0 +1,44 @@
+package terrain_rgb
+
+import (
+	"context"
+	"image"
+	"io"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// TerrainRGBProfile encodes the full elevation of land and water, without masking
+type TerrainRGBProfile struct {
+}
+
+func NewTerrainRGBProfile() *TerrainRGBProfile {
+	return &TerrainRGBProfile{}
+}
+
+func (p *TerrainRGBProfile) Name() string {
+	return "terrain-rgb"
+}
+
+func (p *TerrainRGBProfile) FileType() string {
+	return "png"
+}
+
+func (p *TerrainRGBProfile) MaxZoom() uint32 {
+	return 14
+}
+
+func (p *TerrainRGBProfile) GetImage(ctx context.Context, imgRect image.Rectangle, input colors.ColorInput) (image.Image, error) {
+	output := image.NewNRGBA(imgRect)
+
+	for y, row := range input.DataMap {
+		for x, cell := range row {
+			output.SetNRGBA(x, y, EncodeElevationToTerrainRGB(cell.Elevation()))
+		}
+	}
+	return output, nil
+}
+
+func (p *TerrainRGBProfile) EncodeImage(w io.Writer, image image.Image) error {
+	return noCompressionEncoder().Encode(w, image)
+}
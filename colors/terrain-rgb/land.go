@@ -0,0 +1,54 @@
+package terrain_rgb
+
+import (
+	"context"
+	"image"
+	"io"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// LandTerrainRGBProfile encodes the elevation of land, water is at sea level and ice marked at 3 m
+// (like terrarium-land)
+type LandTerrainRGBProfile struct {
+}
+
+func NewLandTerrainRGBProfile() *LandTerrainRGBProfile {
+	return &LandTerrainRGBProfile{}
+}
+
+func (l *LandTerrainRGBProfile) Name() string {
+	return "terrain-rgb-land"
+}
+
+func (l *LandTerrainRGBProfile) FileType() string {
+	return "png"
+}
+
+func (l *LandTerrainRGBProfile) MaxZoom() uint32 {
+	return 14
+}
+
+func (l *LandTerrainRGBProfile) GetImage(ctx context.Context, imgRect image.Rectangle, input colors.ColorInput) (image.Image, error) {
+	output := image.NewNRGBA(imgRect)
+
+	for y, row := range input.DataMap {
+		for x, cell := range row {
+			if !cell.IsLand() {
+				if cell.IsIce() {
+					output.SetNRGBA(x, y, IceElevation)
+				} else {
+					output.SetNRGBA(x, y, ZeroElevation)
+				}
+				continue
+			}
+
+			output.SetNRGBA(x, y, EncodeElevationToTerrainRGB(cell.Elevation()))
+		}
+	}
+	return output, nil
+}
+
+func (l *LandTerrainRGBProfile) EncodeImage(w io.Writer, image image.Image) error {
+	return noCompressionEncoder().Encode(w, image)
+}
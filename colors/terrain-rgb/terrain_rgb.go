@@ -0,0 +1,44 @@
+package terrain_rgb
+
+import (
+	img_color "image/color"
+	"image/png"
+	"math"
+)
+
+// Mapbox Terrain-RGB encoding: elevation = -10000 + (R * 256 * 256 + G * 256 + B) * 0.1
+const (
+	elevationOffset = 10000
+	elevationScale  = 10
+	maxValue        = 256*256*256 - 1
+)
+
+var (
+	ZeroElevation = EncodeElevationToTerrainRGB(0)
+	IceElevation  = EncodeElevationToTerrainRGB(3)
+)
+
+func noCompressionEncoder() *png.Encoder {
+	return &png.Encoder{
+		CompressionLevel: png.NoCompression,
+		BufferPool:       nil, // Use default buffer pool
+	}
+}
+
+// EncodeElevationToTerrainRGB quantizes the elevation to 0.1 m, clamped to the range of the encoding
+func EncodeElevationToTerrainRGB(elevation float32) img_color.NRGBA {
+	v := int64(math.Round((float64(elevation) + elevationOffset) * elevationScale))
+	v = max(0, min(v, maxValue))
+	return img_color.NRGBA{
+		R: uint8(v >> 16),
+		G: uint8(v >> 8),
+		B: uint8(v),
+		A: 255,
+	}
+}
+
+// DecodeElevationFromTerrainRGB returns the elevation of a Terrain-RGB pixel
+func DecodeElevationFromTerrainRGB(pixel img_color.NRGBA) float32 {
+	v := int64(pixel.R)<<16 | int64(pixel.G)<<8 | int64(pixel.B)
+	return float32(v)/elevationScale - elevationOffset
+}
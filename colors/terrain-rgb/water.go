@@ -0,0 +1,49 @@
+package terrain_rgb
+
+import (
+	"context"
+	"image"
+	"io"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// WaterTerrainRGBProfile encodes the depth of water, land is at sea level (like terrarium-water)
+type WaterTerrainRGBProfile struct {
+}
+
+func NewWaterTerrainRGBProfile() *WaterTerrainRGBProfile {
+	return &WaterTerrainRGBProfile{}
+}
+
+func (w *WaterTerrainRGBProfile) Name() string {
+	return "terrain-rgb-water"
+}
+
+func (w *WaterTerrainRGBProfile) FileType() string {
+	return "png"
+}
+
+func (w *WaterTerrainRGBProfile) MaxZoom() uint32 {
+	return 14
+}
+
+func (w *WaterTerrainRGBProfile) GetImage(ctx context.Context, imgRect image.Rectangle, input colors.ColorInput) (image.Image, error) {
+	output := image.NewNRGBA(imgRect)
+
+	for y, row := range input.DataMap {
+		for x, cell := range row {
+			if cell.IsLand() {
+				output.SetNRGBA(x, y, ZeroElevation)
+				continue
+			}
+
+			output.SetNRGBA(x, y, EncodeElevationToTerrainRGB(cell.Elevation()))
+		}
+	}
+	return output, nil
+}
+
+func (water *WaterTerrainRGBProfile) EncodeImage(w io.Writer, image image.Image) error {
+	return noCompressionEncoder().Encode(w, image)
+}
@@ -0,0 +1,166 @@
+package theme
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// Config is the declarative theme format, read from JSON or YAML files
+type Config struct {
+	// Name is the route of the theme, defaults to the file name without extension
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Version invalidates cached tiles when changed, the content of the file is part of it as well
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// MaxZoom is the highest zoom level served (default 13)
+	MaxZoom *uint32 `json:"maxZoom,omitempty" yaml:"maxZoom,omitempty"`
+	// Format is the output format of the tiles with default options, "png" (default), "jpeg" or "webp"
+	Format colors.ImageFormat `json:"format,omitempty" yaml:"format,omitempty"`
+	// Formats serves the tiles in several formats with options (instead of format), the first is the default
+	Formats []colors.EncoderOptions `json:"formats,omitempty" yaml:"formats,omitempty"`
+	// Palettes are the named palettes. "water" (sea cells) and "normal" (land cells) are required, "ice" (or "polar")
+	// is used for ice cells, others can be referenced by the blend rules.
+	Palettes map[string][]StopConfig `json:"palettes" yaml:"palettes"`
+	// Interpolation is the blending between the stops of all palettes (default gamma 2.2 with smoothstep)
+	Interpolation *colors.Interpolation `json:"interpolation,omitempty" yaml:"interpolation,omitempty"`
+	// PaletteInterpolation overrides the interpolation of single palettes
+	PaletteInterpolation map[string]colors.Interpolation `json:"paletteInterpolation,omitempty" yaml:"paletteInterpolation,omitempty"`
+	// PaletteFiles are palettes read from GDAL color-relief, QGIS XML or GMT cpt files (relative to the theme file)
+	PaletteFiles map[string]string `json:"paletteFiles,omitempty" yaml:"paletteFiles,omitempty"`
+	// PaletteRange is the elevation range of relative positions in palette files (default -12000 to 9000)
+	PaletteRange *colors.PaletteRange `json:"paletteRange,omitempty" yaml:"paletteRange,omitempty"`
+	// SnowLine scales the elevation of land cells by the distance to the equator, before the palettes are applied
+	SnowLine *SnowLineConfig `json:"snowLine,omitempty" yaml:"snowLine,omitempty"`
+	// Blend are the rules to blend palettes into the normal palette, the first rule with a factor above 0 is used
+	Blend []BlendConfig `json:"blend,omitempty" yaml:"blend,omitempty"`
+	// Rock fades land into a rock color on steep slopes
+	Rock *RockConfig `json:"rock,omitempty" yaml:"rock,omitempty"`
+	// Shaded registers an additional "<name>-shaded" theme with the hillshade multiplied into the colors
+	Shaded bool `json:"shaded,omitempty" yaml:"shaded,omitempty"`
+	// Elevation configures the elevation post-processing, defaults to the fix stage only
+	Elevation *ElevationConfig `json:"elevation,omitempty" yaml:"elevation,omitempty"`
+}
+
+// Palette returns the named palette of the config with its interpolation
+func (c Config) Palette(name string) (colors.ColorPalette, error) {
+	stops, ok := c.Palettes[name]
+	if !ok {
+		return colors.ColorPalette{}, fmt.Errorf("palette %s is missing", name)
+	}
+
+	palette, err := toPalette(stops)
+	if err != nil {
+		return colors.ColorPalette{}, err
+	}
+
+	if interpolation, ok := c.PaletteInterpolation[name]; ok {
+		palette.Interpolation = interpolation
+	} else if c.Interpolation != nil {
+		palette.Interpolation = *c.Interpolation
+	}
+	if err := palette.Interpolation.Validate(); err != nil {
+		return colors.ColorPalette{}, err
+	}
+	return palette, nil
+}
+
+// EncoderOptions returns the output formats of the config
+func (c Config) EncoderOptions() ([]colors.EncoderOptions, error) {
+	if c.Format != "" && len(c.Formats) > 0 {
+		return nil, fmt.Errorf("format and formats are both set")
+	}
+
+	formats := c.Formats
+	if len(formats) == 0 {
+		format := c.Format
+		if format == "" {
+			format = colors.FormatPNG
+		}
+		formats = []colors.EncoderOptions{{Format: format}}
+	}
+
+	if err := colors.ValidateFormats(formats); err != nil {
+		return nil, err
+	}
+	return formats, nil
+}
+
+// StopConfig is a color at an elevation in meters
+type StopConfig struct {
+	Elevation float32  `json:"elevation" yaml:"elevation"`
+	Color     HexColor `json:"color" yaml:"color"`
+}
+
+// SnowLineConfig scales the elevation with max(Min, (AquatorFactor/Reference)^Exponent), so the snow
+// colors of the palettes start lower towards the poles
+type SnowLineConfig struct {
+	Reference float64 `json:"reference" yaml:"reference"`
+	Exponent  float64 `json:"exponent" yaml:"exponent"`
+	Min       float64 `json:"min" yaml:"min"`
+}
+
+// BlendConfig blends a palette into the normal palette by a factor of the cell
+type BlendConfig struct {
+	// Factor is the cell factor, "polar", "desert" or "aquator"
+	Factor string `json:"factor" yaml:"factor"`
+	// Palette is the name of the blended palette
+	Palette string `json:"palette" yaml:"palette"`
+	// Ice uses the palette without blending for ice cells within the rule
+	Ice bool `json:"ice,omitempty" yaml:"ice,omitempty"`
+}
+
+// RockConfig fades the normal palette into the rock color between the slopes (in degrees)
+type RockConfig struct {
+	Color      HexColor `json:"color" yaml:"color"`
+	StartSlope float64  `json:"startSlope" yaml:"startSlope"`
+	FullSlope  float64  `json:"fullSlope" yaml:"fullSlope"`
+}
+
+// ElevationConfig enables the elevation post-processing stages (see colors.ElevationOptions)
+type ElevationConfig struct {
+	Fix        *FixConfig       `json:"fix,omitempty" yaml:"fix,omitempty"`
+	Coastlines *CoastlineConfig `json:"coastlines,omitempty" yaml:"coastlines,omitempty"`
+}
+
+// FixConfig enables the fix stage up to the max zoom (all zoom levels if not set)
+type FixConfig struct {
+	MaxZoom *uint32 `json:"maxZoom,omitempty" yaml:"maxZoom,omitempty"`
+}
+
+// CoastlineConfig enables the coastline smoothing, unset values use colors.DefaultCoastlineOptions
+type CoastlineConfig struct {
+	MinZoom   *uint32  `json:"minZoom,omitempty" yaml:"minZoom,omitempty"`
+	MaxZoom   *uint32  `json:"maxZoom,omitempty" yaml:"maxZoom,omitempty"`
+	MixFactor *float32 `json:"mixFactor,omitempty" yaml:"mixFactor,omitempty"`
+	Radius    int      `json:"radius,omitempty" yaml:"radius,omitempty"`
+}
+
+// HexColor is a color written as "#rrggbb" or "#rrggbbaa"
+type HexColor colors.Color
+
+func (c *HexColor) UnmarshalText(text []byte) error {
+	value := strings.TrimPrefix(strings.TrimSpace(string(text)), "#")
+	if len(value) != 6 && len(value) != 8 {
+		return fmt.Errorf("invalid color %q, expected #rrggbb or #rrggbbaa", text)
+	}
+
+	bytes, err := hex.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("invalid color %q: %w", text, err)
+	}
+
+	*c = HexColor{R: bytes[0], G: bytes[1], B: bytes[2], A: 255}
+	if len(bytes) == 4 {
+		c.A = bytes[3]
+	}
+	return nil
+}
+
+func (c HexColor) MarshalText() ([]byte, error) {
+	if c.A == 255 {
+		return fmt.Appendf(nil, "#%02x%02x%02x", c.R, c.G, c.B), nil
+	}
+	return fmt.Appendf(nil, "#%02x%02x%02x%02x", c.R, c.G, c.B, c.A), nil
+}
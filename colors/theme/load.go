@@ -0,0 +1,137 @@
+package theme
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadThemeFile reads a theme from a JSON (.json) or YAML (.yaml, .yml) file
+func LoadThemeFile(path string) (*ThemeProvider, Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, config, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+	default:
+		return nil, config, fmt.Errorf("unsupported theme file extension %q", ext)
+	}
+	if err != nil {
+		return nil, config, fmt.Errorf("failed to parse theme %s: %w", path, err)
+	}
+
+	if config.Name == "" {
+		config.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	// The palette files are part of the content hash, so changing them invalidates the cached tiles
+	hash := sha256.New()
+	hash.Write(data)
+	if err := loadPaletteFiles(&config, filepath.Dir(path), hash); err != nil {
+		return nil, config, fmt.Errorf("%s: %w", path, err)
+	}
+
+	provider, err := NewThemeProvider(config, hex.EncodeToString(hash.Sum(nil)[:4]))
+	if err != nil {
+		return nil, config, fmt.Errorf("%s: %w", path, err)
+	}
+	return provider, config, nil
+}
+
+// loadPaletteFiles adds the palettes of the palette files to the config
+func loadPaletteFiles(config *Config, dir string, hash io.Writer) error {
+	valueRange := colors.DefaultPaletteRange
+	if config.PaletteRange != nil {
+		valueRange = *config.PaletteRange
+	}
+
+	names := make([]string, 0, len(config.PaletteFiles))
+	for name := range config.PaletteFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := config.PaletteFiles[name]
+		if _, exists := config.Palettes[name]; exists {
+			return fmt.Errorf("palette %s is defined by stops and a file", name)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		hash.Write(content)
+
+		palette, err := colors.LoadPaletteFile(file, valueRange)
+		if err != nil {
+			return err
+		}
+
+		stops := make([]StopConfig, len(palette.Stops))
+		for i, stop := range palette.Stops {
+			stops[i] = StopConfig{Elevation: stop.Elevation, Color: HexColor(stop.Color)}
+		}
+		if config.Palettes == nil {
+			config.Palettes = make(map[string][]StopConfig)
+		}
+		config.Palettes[name] = stops
+	}
+	return nil
+}
+
+// LoadThemes loads all theme files of the directory (in name order), including the shaded variants
+func LoadThemes(dir string, hillshade colors.HillshadeOptions) ([]colors.ColorProvider, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []colors.ColorProvider
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+
+		provider, config, err := LoadThemeFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, provider)
+		if config.Shaded {
+			providers = append(providers, provider.Shaded(hillshade))
+		}
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,283 @@
+package theme
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+)
+
+// defaultMaxZoom is the max zoom of themes without maxZoom, like the built-in color themes
+const defaultMaxZoom = 13
+
+// blendRule is a resolved blend rule of the config
+type blendRule struct {
+	factor  func(cell colors.DataCell) float64
+	palette *colors.PaletteLUT
+	ice     bool
+}
+
+// ThemeProvider renders a theme loaded from a theme file
+type ThemeProvider struct {
+	name      string
+	version   string
+	maxZoom   uint32
+	water     *colors.PaletteLUT
+	normal    *colors.PaletteLUT
+	ice       *colors.PaletteLUT
+	snowLine  *SnowLineConfig
+	blend     []blendRule
+	rock      *RockConfig
+	elevation colors.ElevationOptions
+	hillshade *colors.HillshadeOptions
+	formats   []colors.EncoderOptions
+}
+
+// NewThemeProvider validates the config and creates its provider, hash identifies the content of the theme file
+func NewThemeProvider(config Config, hash string) (*ThemeProvider, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("theme has no name")
+	}
+	formats, err := config.EncoderOptions()
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", config.Name, err)
+	}
+
+	palettes := make(map[string]*colors.PaletteLUT, len(config.Palettes))
+	for name := range config.Palettes {
+		palette, err := config.Palette(name)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: palette %s: %w", config.Name, name, err)
+		}
+		palettes[name] = colors.NewPaletteLUT(palette)
+	}
+
+	for name := range config.PaletteInterpolation {
+		if _, ok := palettes[name]; !ok {
+			return nil, fmt.Errorf("theme %s: interpolation of unknown palette %s", config.Name, name)
+		}
+	}
+
+	provider := &ThemeProvider{
+		name:      config.Name,
+		version:   hash,
+		maxZoom:   defaultMaxZoom,
+		snowLine:  config.SnowLine,
+		rock:      config.Rock,
+		elevation: toElevationOptions(config.Elevation),
+		formats:   formats,
+	}
+	if config.Version != "" {
+		provider.version = config.Version + "-" + hash
+	}
+	if config.MaxZoom != nil {
+		provider.maxZoom = *config.MaxZoom
+	}
+
+	var ok bool
+	if provider.water, ok = palettes["water"]; !ok {
+		return nil, fmt.Errorf("theme %s: palette water is missing", config.Name)
+	}
+	if provider.normal, ok = palettes["normal"]; !ok {
+		return nil, fmt.Errorf("theme %s: palette normal is missing", config.Name)
+	}
+	if provider.ice, ok = palettes["ice"]; !ok {
+		if provider.ice, ok = palettes["polar"]; !ok {
+			provider.ice = provider.normal
+		}
+	}
+
+	if provider.snowLine != nil && provider.snowLine.Reference <= 0 {
+		return nil, fmt.Errorf("theme %s: snow line reference must be positive", config.Name)
+	}
+
+	for i, rule := range config.Blend {
+		palette, ok := palettes[rule.Palette]
+		if !ok {
+			return nil, fmt.Errorf("theme %s: blend rule %d: palette %s is missing", config.Name, i, rule.Palette)
+		}
+		factor, err := cellFactor(rule.Factor)
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: blend rule %d: %w", config.Name, i, err)
+		}
+		provider.blend = append(provider.blend, blendRule{factor: factor, palette: palette, ice: rule.Ice})
+	}
+
+	return provider, nil
+}
+
+// toPalette converts the stops, which must be ordered by elevation, a single stop colors all elevations
+func toPalette(stops []StopConfig) (colors.ColorPalette, error) {
+	if len(stops) == 0 {
+		return colors.ColorPalette{}, fmt.Errorf("no color stops")
+	}
+
+	palette := colors.ColorPalette{Stops: make([]colors.ColorStop, len(stops))}
+	for i, stop := range stops {
+		if i > 0 && stop.Elevation < stops[i-1].Elevation {
+			return colors.ColorPalette{}, fmt.Errorf("stops are not ordered by elevation")
+		}
+		palette.Stops[i] = colors.ColorStop{Elevation: stop.Elevation, Color: colors.Color(stop.Color)}
+	}
+	return palette, nil
+}
+
+// cellFactor returns the accessor of the named factor of a cell
+func cellFactor(name string) (func(cell colors.DataCell) float64, error) {
+	switch name {
+	case "polar":
+		return colors.DataCell.PolarFactor, nil
+	case "desert":
+		return colors.DataCell.DesertFactor, nil
+	case "aquator":
+		return colors.DataCell.AquatorFactor, nil
+	default:
+		return nil, fmt.Errorf("unknown factor %q, expected polar, desert or aquator", name)
+	}
+}
+
+// toElevationOptions converts the elevation config, nil uses the default post-processing
+func toElevationOptions(config *ElevationConfig) colors.ElevationOptions {
+	if config == nil {
+		return colors.DefaultElevationOptions()
+	}
+
+	var options colors.ElevationOptions
+	if config.Fix != nil {
+		options.Fix = &colors.FixElevationOptions{MaxZoom: math.MaxUint32}
+		if config.Fix.MaxZoom != nil {
+			options.Fix.MaxZoom = *config.Fix.MaxZoom
+		}
+	}
+	if config.Coastlines != nil {
+		coastlines := colors.DefaultCoastlineOptions()
+		if config.Coastlines.MinZoom != nil {
+			coastlines.MinZoom = *config.Coastlines.MinZoom
+		}
+		if config.Coastlines.MaxZoom != nil {
+			coastlines.MaxZoom = *config.Coastlines.MaxZoom
+		}
+		if config.Coastlines.MixFactor != nil {
+			coastlines.MixFactor = *config.Coastlines.MixFactor
+		}
+		coastlines.Radius = config.Coastlines.Radius
+		options.Coastlines = &coastlines
+	}
+	return options
+}
+
+// Shaded returns a copy of the theme with the hillshade multiplied into the colors, named "<name>-shaded"
+func (p *ThemeProvider) Shaded(options colors.HillshadeOptions) *ThemeProvider {
+	shaded := *p
+	shaded.name = p.name + "-shaded"
+	shaded.version = p.version + "-" + options.String()
+	shaded.hillshade = &options
+	return &shaded
+}
+
+func (p *ThemeProvider) Name() string {
+	return p.name
+}
+
+func (p *ThemeProvider) Version() string {
+	return p.version
+}
+
+func (p *ThemeProvider) FileType() string {
+	return p.formats[0].Extension()
+}
+
+func (p *ThemeProvider) Formats() []colors.EncoderOptions {
+	return p.formats
+}
+
+func (p *ThemeProvider) MaxZoom() uint32 {
+	return p.maxZoom
+}
+
+func (p *ThemeProvider) HillshadeOptions() *colors.HillshadeOptions {
+	return p.hillshade
+}
+
+func (p *ThemeProvider) ElevationOptions() colors.ElevationOptions {
+	return p.elevation
+}
+
+func (p *ThemeProvider) GetImage(ctx context.Context, imgRect image.Rectangle, input colors.ColorInput) (image.Image, error) {
+	if input.Zoom > p.MaxZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported", input.Zoom)
+	}
+
+	if len(input.DataMap) == 0 {
+		return nil, fmt.Errorf("data map is empty")
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	output := image.NewNRGBA(imgRect)
+	for y, row := range input.DataMap {
+		for x, cell := range row {
+			output.SetNRGBA(x, y, p.cellColor(cell).RGBA())
+		}
+	}
+
+	if p.hillshade != nil && input.Hillshade != nil {
+		colors.ApplyHillshade(output, input.Hillshade, *p.hillshade)
+	}
+
+	return output, nil
+}
+
+// cellColor applies the palettes and rules of the theme to a cell
+func (p *ThemeProvider) cellColor(cell colors.DataCell) colors.Color {
+	elevation := cell.Elevation()
+
+	if !cell.IsLand() {
+		if cell.IsIce() {
+			return p.ice.Color(elevation)
+		}
+		return p.water.Color(elevation)
+	}
+
+	if p.snowLine != nil {
+		factor := math.Max(p.snowLine.Min, math.Pow(cell.AquatorFactor()/p.snowLine.Reference, p.snowLine.Exponent))
+		elevation = elevation * float32(factor)
+	}
+
+	for _, rule := range p.blend {
+		factor := rule.factor(cell)
+		if factor <= 0 {
+			continue
+		}
+
+		color := rule.palette.Color(elevation)
+		if factor >= 1 || (rule.ice && cell.IsIce()) {
+			return color
+		}
+		return colors.MixColors(p.normal.Color(elevation), color, factor)
+	}
+
+	if cell.IsIce() {
+		return p.ice.Color(elevation)
+	}
+
+	color := p.normal.Color(elevation)
+	if p.rock != nil && p.rock.FullSlope > p.rock.StartSlope {
+		factor := math.Max(0, math.Min(1, (cell.Slope()-p.rock.StartSlope)/(p.rock.FullSlope-p.rock.StartSlope)))
+		if factor > 0 {
+			rock := colors.Color(p.rock.Color)
+			rock.A = color.A
+			color = colors.MixColors(color, rock, factor)
+		}
+	}
+	return color
+}
+
+func (p *ThemeProvider) EncodeImage(w io.Writer, img image.Image) error {
+	return p.formats[0].Encode(w, img)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+const (
+	// contourVersion invalidates the cached contour tiles when their output changes
+	contourVersion = "1"
+	// contourMaxZoom is the highest zoom level of the contour tiles
+	contourMaxZoom = 15
+	// contourMajorEvery marks every n-th contour line (multiples of n times the interval) as major (index) line
+	contourMajorEvery = 5
+	// contourMinBuffer is the buffer needed to join the contour lines of neighbor tiles
+	contourMinBuffer = 2
+	// contourClipBuffer is the area beyond the tile extent in which lines are kept, to avoid line caps at the edges
+	contourClipBuffer = 64
+	// contourSimplify is the tolerance of the line simplification, in tile extent units
+	contourSimplify = 1
+
+	contourLandLayer  = "contour"
+	contourWaterLayer = "bathymetry"
+)
+
+// contourIntervals are the contour intervals in meters by zoom level, the last one applies to all higher zoom levels
+var contourIntervals = []float64{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 500, 200, 100, 50, 50, 20, 10}
+
+// contourInterval returns the contour interval in meters of the zoom level
+func contourInterval(z uint32) float64 {
+	return contourIntervals[min(int(z), len(contourIntervals)-1)]
+}
+
+// configureContourHandler serves the contour lines as Mapbox Vector Tiles, with the lines on land in the
+// "contour" layer and the bathymetric ones in the "bathymetry" layer
+func configureContourHandler(geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	tileCache := config.TileCache
+	options := colors.DefaultElevationOptions()
+	pipeline := NewElevationPipeline(options, geoCoverage)
+	buffer := max(config.Buffer, contourMinBuffer)
+	maxZoom := min(contourMaxZoom, source.MaxTileZoom())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		z, x, y, err := parseTileCoord(mux.Vars(r), maxZoom)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		defer cancel()
+
+		log.Printf("/contours/%d/%d/%d.pbf", z, y, x)
+		defer func() {
+			log.Printf("/contours/%d/%d/%d.pbf - %s", z, y, x, time.Since(start).Round(time.Millisecond))
+		}()
+
+		key := tileCache.key("contours", contourVersion, options, z, x, y, "pbf")
+		serveTile(ctx, w, r, tileCache, key, cacheControl, "application/vnd.mapbox-vector-tile", func(ctx context.Context) ([]byte, error) {
+			return renderContourTile(ctx, geoCoverage, pipeline, source, buffer, z, x, y)
+		})
+	}
+}
+
+// renderContourTile traces the contour lines of the (post-processed) elevation and encodes them as vector tile
+func renderContourTile(ctx context.Context, geoCoverage *terrain.GeoCoverage, pipeline ElevationPipeline, source terrain.ElevationSource, buffer int, z, x, y uint32) ([]byte, error) {
+	elevationMap, err := terrain.GetBufferedElevationMap(ctx, source, terrain.TileCoord{Z: z, Y: y, X: x}, buffer)
+	if err != nil {
+		return nil, errors.New("Failed to get source data for tile")
+	}
+
+	tile := terrain.CreateTileBounds(z, y, x, elevationMap.TileSize)
+
+	if err := pipeline.Process(ctx, elevationMap, tile); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New("Failed to process elevation data")
+	}
+
+	interval := contourInterval(z)
+	land := &mvt.Layer{Name: contourLandLayer, Version: 2, Extent: mvt.DefaultExtent}
+	water := &mvt.Layer{Name: contourWaterLayer, Version: 2, Extent: mvt.DefaultExtent}
+	scale := float64(mvt.DefaultExtent) / float64(elevationMap.TileSize)
+
+	// All lines of a level and layer are one feature
+	var landLines, waterLines orb.MultiLineString
+	contours := elevationMap.TraceContours(interval)
+	for i, contour := range contours {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// The coastline is no contour line
+		if contour.Elevation != 0 {
+			for _, part := range splitContourByLand(contour, tile, geoCoverage) {
+				line := make(orb.LineString, len(part.line))
+				for j, point := range part.line {
+					line[j] = orb.Point{point[0] * scale, point[1] * scale}
+				}
+				if part.land {
+					landLines = append(landLines, line)
+				} else {
+					waterLines = append(waterLines, line)
+				}
+			}
+		}
+
+		if i+1 == len(contours) || contours[i+1].Elevation != contour.Elevation {
+			addContourFeature(land, landLines, contour.Elevation, interval)
+			addContourFeature(water, waterLines, contour.Elevation, interval)
+			landLines, waterLines = nil, nil
+		}
+	}
+
+	layers := mvt.Layers{land, water}
+	layers.Clip(orb.Bound{
+		Min: orb.Point{-contourClipBuffer, -contourClipBuffer},
+		Max: orb.Point{mvt.DefaultExtent + contourClipBuffer, mvt.DefaultExtent + contourClipBuffer},
+	})
+	layers.Simplify(simplify.DouglasPeucker(contourSimplify))
+	layers.RemoveEmpty(contourSimplify, 0)
+
+	data, err := mvt.Marshal(layers)
+	if err != nil {
+		return nil, errors.New("Failed to encode vector tile")
+	}
+	return data, nil
+}
+
+// addContourFeature adds the lines of a level with the "ele" (meters) and "index" ("major" or "minor") properties
+func addContourFeature(layer *mvt.Layer, lines orb.MultiLineString, elevation, interval float64) {
+	if len(lines) == 0 {
+		return
+	}
+
+	index := "minor"
+	if int64(elevation/interval)%contourMajorEvery == 0 {
+		index = "major"
+	}
+
+	feature := geojson.NewFeature(lines)
+	feature.Properties["ele"] = int64(elevation)
+	feature.Properties["index"] = index
+	layer.Features = append(layer.Features, feature)
+}
+
+// contourPart is a part of a contour line, either on land or on water
+type contourPart struct {
+	line orb.LineString
+	land bool
+}
+
+// splitContourByLand splits the line where it changes between land and water, each segment is classified
+// at its center like the pixels of the color themes
+func splitContourByLand(contour terrain.ContourLine, tile *terrain.TileBounds, geoCoverage *terrain.GeoCoverage) []contourPart {
+	var parts []contourPart
+	for i := 0; i+1 < len(contour.Line); i++ {
+		from, to := contour.Line[i], contour.Line[i+1]
+		// Pixel coordinates are at the center of the pixels, the tile bounds at their corner
+		lat, lng := tile.GetLatLng((from[0]+to[0])/2-0.5, (from[1]+to[1])/2-0.5)
+		land := isLand(float32(contour.Elevation), lng, lat, geoCoverage)
+
+		if n := len(parts); n > 0 && parts[n-1].land == land {
+			parts[n-1].line = append(parts[n-1].line, to)
+			continue
+		}
+		parts = append(parts, contourPart{line: orb.LineString{from, to}, land: land})
+	}
+	return parts
+}
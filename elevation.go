@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+)
+
+const (
+	// elevationMaxPoints is the max number of points of a batch request
+	elevationMaxPoints = 1000
+	// elevationMaxBodyBytes is the max size of a batch request body
+	elevationMaxBodyBytes = 1 << 20
+)
+
+// elevationPoint is a location of a batch request
+type elevationPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// elevationRequest is the body of a batch request, Zoom is optional (default the max zoom of the source with the
+// full resolution of the data)
+type elevationRequest struct {
+	Zoom   *uint32          `json:"z,omitempty"`
+	Points []elevationPoint `json:"points"`
+}
+
+// elevationResult is the (post-processed) elevation of a location with its classification as used by the
+// color themes
+type elevationResult struct {
+	Lat          float64 `json:"lat"`
+	Lon          float64 `json:"lon"`
+	Elevation    float32 `json:"elevation"`
+	Land         bool    `json:"land"`
+	Ice          bool    `json:"ice"`
+	DesertFactor float64 `json:"desertFactor"`
+	PolarFactor  float64 `json:"polarFactor"`
+	Zoom         uint32  `json:"zoom"`
+}
+
+// configureElevationHandler serves the elevation of single locations (GET /elevation?lat=..&lon=..&z=..) and of
+// many locations at once (POST /elevation with an elevationRequest body)
+func configureElevationHandler(geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	pipeline := NewElevationPipeline(colors.DefaultElevationOptions(), geoCoverage)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var request elevationRequest
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+			if err != nil {
+				http.Error(w, "Invalid lat parameter", http.StatusBadRequest)
+				return
+			}
+			lon, err := strconv.ParseFloat(query.Get("lon"), 64)
+			if err != nil {
+				http.Error(w, "Invalid lon parameter", http.StatusBadRequest)
+				return
+			}
+			if query.Has("z") {
+				zoom, err := strconv.ParseUint(query.Get("z"), 10, 32)
+				if err != nil {
+					http.Error(w, "Invalid z parameter", http.StatusBadRequest)
+					return
+				}
+				z := uint32(zoom)
+				request.Zoom = &z
+			}
+			request.Points = []elevationPoint{{Lat: lat, Lon: lon}}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, elevationMaxBodyBytes)).Decode(&request); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if len(request.Points) > elevationMaxPoints {
+				http.Error(w, fmt.Sprintf("Too many points, at most %d are allowed", elevationMaxPoints), http.StatusBadRequest)
+				return
+			}
+		}
+
+		for _, point := range request.Points {
+			if err := validateLocation(point.Lat, point.Lon); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		defer cancel()
+
+		zoom := source.MaxZoom()
+		if request.Zoom != nil {
+			zoom = min(max(*request.Zoom, source.MinZoom()), source.MaxTileZoom())
+		}
+
+		log.Printf("%s /elevation %d points (zoom %d)", r.Method, len(request.Points), zoom)
+		defer func() {
+			log.Printf("%s /elevation %d points (zoom %d) - %s", r.Method, len(request.Points), zoom, time.Since(start).Round(time.Millisecond))
+		}()
+
+		sampler := NewElevationSampler(source, pipeline, zoom)
+		results := make([]elevationResult, len(request.Points))
+		for i, point := range request.Points {
+			result, err := sampleElevationPoint(ctx, geoCoverage, sampler, point.Lat, point.Lon)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			results[i] = result
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Header().Set("Cache-Control", cacheControl)
+			json.NewEncoder(w).Encode(results[0])
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Results []elevationResult `json:"results"`
+		}{results})
+	}
+}
+
+// validateLocation checks that the location is a valid coordinate in degrees
+func validateLocation(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("Invalid latitude %v", lat)
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("Invalid longitude %v", lon)
+	}
+	return nil
+}
+
+// sampleElevationPoint samples the elevation at the location and classifies it like the pixels of the color themes
+func sampleElevationPoint(ctx context.Context, geoCoverage *terrain.GeoCoverage, sampler *ElevationSampler, lat, lon float64) (elevationResult, error) {
+	elevation, err := sampler.Elevation(ctx, lat, lon)
+	if err != nil {
+		return elevationResult{}, errors.New("Failed to get source data for location")
+	}
+
+	cell := &PixelCell{elevation: elevation, latitude: lat, longitude: lon, geoCoverage: geoCoverage}
+	return elevationResult{
+		Lat:          lat,
+		Lon:          lon,
+		Elevation:    elevation,
+		Land:         cell.IsLand(),
+		Ice:          cell.IsIce(),
+		DesertFactor: cell.DesertFactor(),
+		PolarFactor:  cell.PolarFactor(),
+		Zoom:         sampler.Zoom(),
+	}, nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"log"
@@ -15,126 +17,235 @@ import (
 	"github.com/mxzinke/colorful-terrarium/colors/color_v1"
 	"github.com/mxzinke/colorful-terrarium/colors/color_v2"
 	"github.com/mxzinke/colorful-terrarium/colors/custom_ikarus"
+	"github.com/mxzinke/colorful-terrarium/colors/hillshade"
 	mono_terrain "github.com/mxzinke/colorful-terrarium/colors/mono-terrain"
+	terrain_rgb "github.com/mxzinke/colorful-terrarium/colors/terrain-rgb"
 	"github.com/mxzinke/colorful-terrarium/colors/terrarium"
 	"github.com/mxzinke/colorful-terrarium/terrain"
 )
 
-func MainHandler(geoCoverage *terrain.GeoCoverage) http.Handler {
+// HandlerConfig configures the tile handlers
+type HandlerConfig struct {
+	// TileCache caches the rendered tiles
+	TileCache *TileCache
+	// MaxAge is the max-age of the Cache-Control header
+	MaxAge time.Duration
+	// Hillshade configures the lighting of the hillshade themes
+	Hillshade colors.HillshadeOptions
+	// Buffer is the number of pixels fetched from the neighbor tiles for seamless edges
+	Buffer int
+	// Themes are additional providers, e.g. loaded from theme files
+	Themes []colors.ColorProvider
+}
+
+func MainHandler(geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.Handler {
 	mux := mux.NewRouter()
 
 	providers := []colors.ColorProvider{
 		color_v1.NewColorV1Provider(),
+		color_v1.NewShadedColorV1Provider(config.Hillshade),
 		color_v2.NewColorV2Provider(),
+		color_v2.NewShadedColorV2Provider(config.Hillshade),
+		hillshade.NewHillshadeProvider(config.Hillshade),
+		hillshade.NewHillshadeOverlayProvider(config.Hillshade),
 		custom_ikarus.NewCustomerProvider(),
 		terrarium.NewLandTerrariumProfile(),
 		terrarium.NewWaterTerrariumProfile(),
 		mono_terrain.NewLandMonoTerrainProfile(),
 		mono_terrain.NewWaterMonoTerrainProfile(),
+		terrain_rgb.NewTerrainRGBProfile(),
+		terrain_rgb.NewLandTerrainRGBProfile(),
+		terrain_rgb.NewWaterTerrainRGBProfile(),
 	}
 
+	names := make(map[string]bool, len(providers))
 	for _, provider := range providers {
-		handler := configureHandler(provider, geoCoverage)
-		mux.HandleFunc(fmt.Sprintf("/%s/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.%s", provider.Name(), provider.FileType()), handler)
+		names[provider.Name()] = true
+	}
+	for _, theme := range config.Themes {
+		if names[theme.Name()] {
+			log.Printf("WARNING: theme %s is already registered, skipping it", theme.Name())
+			continue
+		}
+		names[theme.Name()] = true
+		providers = append(providers, theme)
 	}
 
-	terrariumLandHandler := configureHandler(terrarium.NewLandTerrariumProfile(), geoCoverage)
-	mux.HandleFunc("/terrarium-land/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.png", terrariumLandHandler)
+	// Each format of a provider has its own extension, e.g. /color-v1/{z}/{y}/{x}.webp and /static/color-v1.webp
+	for _, provider := range providers {
+		for _, encoder := range colors.ProviderEncoders(provider) {
+			handler := configureHandler(provider, encoder, geoCoverage, source, config)
+			mux.HandleFunc(fmt.Sprintf("/%s/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.%s", provider.Name(), encoder.Extension()), handler)
+			mux.HandleFunc(fmt.Sprintf("/static/%s.%s", provider.Name(), encoder.Extension()), configureStaticMapHandler(provider, encoder, geoCoverage, source, config))
+		}
+	}
 
-	terrariumWaterHandler := configureHandler(terrarium.NewWaterTerrariumProfile(), geoCoverage)
-	mux.HandleFunc("/terrarium-water/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.png", terrariumWaterHandler)
+	mux.HandleFunc("/contours/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.pbf", configureContourHandler(geoCoverage, source, config))
+	configureQuantizedMeshHandlers(mux, geoCoverage, source, config)
+	mux.HandleFunc("/elevation", configureElevationHandler(geoCoverage, source, config)).Methods(http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/profile", configureProfileHandler(geoCoverage, source, config)).Methods(http.MethodGet, http.MethodPost)
 
 	return mux
 }
 
-func configureHandler(provider colors.ColorProvider, geoCoverage *terrain.GeoCoverage) http.HandlerFunc {
+func configureHandler(provider colors.ColorProvider, encoder colors.ImageEncoder, geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	tileCache := config.TileCache
+	pipeline := NewElevationPipeline(colors.ProviderElevationOptions(provider), geoCoverage)
+	// Up to the max zoom of the provider, as far as the source serves it
+	maxZoom := min(provider.MaxZoom(), source.MaxTileZoom())
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		vars := mux.Vars(r)
 
-		z, err := strconv.ParseUint(vars["z"], 10, 8)
+		z, x, y, err := parseTileCoord(mux.Vars(r), maxZoom)
 		if err != nil {
-			http.Error(w, "Invalid zoom level", http.StatusBadRequest)
-			return
-		}
-
-		if uint32(z) > provider.MaxZoom() {
-			http.Error(w, "Zoom level too high", http.StatusBadRequest)
-			return
-		}
-
-		maxScale := uint64(math.Pow(2, float64(z)))
-
-		y, err := strconv.ParseUint(vars["y"], 10, 32)
-		if err != nil || y >= maxScale {
-			http.Error(w, "Invalid y coordinate", http.StatusBadRequest)
-			return
-		}
-
-		x, err := strconv.ParseUint(vars["x"], 10, 32)
-		if err != nil || x >= maxScale {
-			http.Error(w, "Invalid x coordinate", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 		defer cancel()
 
-		log.Printf("/%s/%d/%d/%d.%s", provider.Name(), z, y, x, provider.FileType())
+		log.Printf("/%s/%d/%d/%d.%s", provider.Name(), z, y, x, encoder.Extension())
 		defer func() {
-			log.Printf("/%s/%d/%d/%d.%s - %s", provider.Name(), z, y, x, provider.FileType(), time.Since(start).Round(time.Millisecond))
+			log.Printf("/%s/%d/%d/%d.%s - %s", provider.Name(), z, y, x, encoder.Extension(), time.Since(start).Round(time.Millisecond))
 		}()
 
-		// Download subtiles
-		elevationMap, err := terrain.GetElevationMapForTerrarium(ctx, terrain.TileCoord{Z: uint32(z), Y: uint32(y), X: uint32(x)})
-		if err != nil {
-			http.Error(w, "Failed to get source data for tile", http.StatusInternalServerError)
-			return
-		}
+		key := tileCache.tileKey(provider, encoder.Extension(), z, x, y)
+		serveTile(ctx, w, r, tileCache, key, cacheControl, "", func(ctx context.Context) ([]byte, error) {
+			return renderTile(ctx, provider, encoder, geoCoverage, pipeline, source, config.Buffer, z, x, y)
+		})
+	}
+}
 
-		// Create tile bounds (calculation for pixel lat/lng mapping)
-		tile := CreateTileBounds(uint32(z), uint32(y), uint32(x), elevationMap.TileSize)
+// parseTileCoord parses the z, y and x route variables of a tile, the zoom level must not exceed maxZoom
+func parseTileCoord(vars map[string]string, maxZoom uint32) (z, x, y uint32, err error) {
+	return parseTileCoordColumns(vars, maxZoom, 1)
+}
 
-		// Fixing the elevation data on some parts of the world
-		fixElevationMap(elevationMap, tile, geoCoverage)
+// parseTileCoordColumns parses the route variables of a tiling scheme with the number of columns at zoom level 0
+// (e.g. 2 of the geographic scheme)
+func parseTileCoordColumns(vars map[string]string, maxZoom uint32, columns uint64) (z, x, y uint32, err error) {
+	zoom, err := strconv.ParseUint(vars["z"], 10, 8)
+	if err != nil {
+		return 0, 0, 0, errors.New("Invalid zoom level")
+	}
 
-		cells, err := GetCellsForTile(elevationMap, tile, geoCoverage)
-		if err != nil {
-			http.Error(w, "Failed to get cells for tile", http.StatusInternalServerError)
-			return
-		}
+	if uint32(zoom) > maxZoom {
+		return 0, 0, 0, errors.New("Zoom level too high")
+	}
 
-		// Convert cells ([][]*PixelCell) to [][]colors.DataCell
-		dataMap := make([][]colors.DataCell, len(cells))
-		for i, row := range cells {
-			dataMap[i] = make([]colors.DataCell, len(row))
-			for j, cell := range row {
-				dataMap[i][j] = cell
-			}
-		}
+	maxScale := uint64(math.Pow(2, float64(zoom)))
 
-		// Get color for each cell
-		imgRect := image.Rect(0, 0, elevationMap.TileSize, elevationMap.TileSize)
+	tileY, err := strconv.ParseUint(vars["y"], 10, 32)
+	if err != nil || tileY >= maxScale {
+		return 0, 0, 0, errors.New("Invalid y coordinate")
+	}
 
-		img, err := provider.GetImage(ctx, imgRect, colors.ColorInput{
-			Zoom:    uint32(z),
-			DataMap: dataMap,
-		})
-		if err != nil {
-			http.Error(w, "Failed to get color pixels on tile", http.StatusInternalServerError)
+	tileX, err := strconv.ParseUint(vars["x"], 10, 32)
+	if err != nil || tileX >= maxScale*columns {
+		return 0, 0, 0, errors.New("Invalid x coordinate")
+	}
+
+	return uint32(zoom), uint32(tileX), uint32(tileY), nil
+}
+
+// serveTile responds with the cached tile, or renders and caches it (once for concurrent requests). An empty
+// content type is detected from the data.
+func serveTile(ctx context.Context, w http.ResponseWriter, r *http.Request, tileCache *TileCache, key, cacheControl, contentType string, render func(ctx context.Context) ([]byte, error)) {
+	tile, err := tileCache.GetOrRender(ctx, key, render)
+	if err != nil {
+		if ctx.Err() != nil {
 			return
 		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Handles If-None-Match / If-Modified-Since with 304 responses
+	w.Header().Set("ETag", tile.etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, "", tile.modified, bytes.NewReader(tile.data))
+}
+
+// renderTile runs the full pipeline (elevation, post-processing, cells, colors) and encodes the tile
+func renderTile(ctx context.Context, provider colors.ColorProvider, encoder colors.ImageEncoder, geoCoverage *terrain.GeoCoverage, pipeline ElevationPipeline, source terrain.ElevationSource, buffer int, z, x, y uint32) ([]byte, error) {
+	img, err := renderTileImage(ctx, provider, geoCoverage, pipeline, source, buffer, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, errors.New("Failed to encode image")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderTileImage runs the full pipeline (elevation, post-processing, cells, colors) for the image of the tile
+func renderTileImage(ctx context.Context, provider colors.ColorProvider, geoCoverage *terrain.GeoCoverage, pipeline ElevationPipeline, source terrain.ElevationSource, buffer int, z, x, y uint32) (image.Image, error) {
+	// Fetch the elevation of the tile, with a buffer from the neighbor tiles
+	elevationMap, err := terrain.GetBufferedElevationMap(ctx, source, terrain.TileCoord{Z: z, Y: y, X: x}, buffer)
+	if err != nil {
+		return nil, errors.New("Failed to get source data for tile")
+	}
+
+	// Create tile bounds (calculation for pixel lat/lng mapping)
+	tile := terrain.CreateTileBounds(z, y, x, elevationMap.TileSize)
 
+	// Post-processing of the elevation (fixes, smoothing) as configured by the provider
+	if err := pipeline.Process(ctx, elevationMap, tile); err != nil {
 		if ctx.Err() != nil {
-			return
+			return nil, ctx.Err()
 		}
+		return nil, errors.New("Failed to process elevation data")
+	}
 
-		w.WriteHeader(http.StatusOK)
+	cells, err := GetCellsForTile(elevationMap, tile, geoCoverage)
+	if err != nil {
+		return nil, errors.New("Failed to get cells for tile")
+	}
 
-		err = provider.EncodeImage(w, img)
-		if err != nil {
-			http.Error(w, "Failed to encode image", http.StatusInternalServerError)
-			return
+	// Convert cells ([][]*PixelCell) to [][]colors.DataCell
+	dataMap := make([][]colors.DataCell, len(cells))
+	for i, row := range cells {
+		dataMap[i] = make([]colors.DataCell, len(row))
+		for j, cell := range row {
+			dataMap[i][j] = cell
 		}
 	}
+
+	input := colors.ColorInput{
+		Zoom:    z,
+		DataMap: dataMap,
+	}
+
+	if hillshadeProvider, ok := provider.(colors.HillshadeProvider); ok {
+		if options := hillshadeProvider.HillshadeOptions(); options != nil {
+			method, err := terrain.ParseSlopeMethod(options.Method)
+			if err != nil {
+				return nil, err
+			}
+			input.Hillshade = terrain.ComputeHillshade(elevationMap, tile, method, options.Azimuth, options.Altitude, options.ZFactor)
+		}
+	}
+
+	// Get color for each cell
+	imgRect := image.Rect(0, 0, elevationMap.TileSize, elevationMap.TileSize)
+
+	img, err := provider.GetImage(ctx, imgRect, input)
+	if err != nil {
+		return nil, errors.New("Failed to get color pixels on tile")
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return img, nil
 }
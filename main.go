@@ -2,10 +2,15 @@ package main
 
 import (
 	"compress/zlib"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/handlers"
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/colors/theme"
 	"github.com/mxzinke/colorful-terrarium/terrain"
 )
 
@@ -14,18 +19,78 @@ const (
 )
 
 func main() {
+	sourceSpec := flag.String("source", "terrarium", "elevation source as <kind>[:<location>][#encoding=<name>], e.g. terrarium or geotiff:https://host/{z}/{x}/{y}.tif")
+	diskCacheDir := flag.String("disk-cache", "", "directory of the persistent cache for downloaded upstream tiles (disabled if empty)")
+	diskCacheSize := flag.Int64("disk-cache-size", 10240, "maximum size of the disk cache in MB (0 for unlimited)")
+	diskCacheMaxAge := flag.Duration("disk-cache-max-age", 0, "maximum age of files in the disk cache, e.g. 720h (0 for unlimited)")
+	cacheSize := flag.Int64("cache-size", 512, "maximum memory of the elevation cache in MB (0 for unlimited)")
+	cacheEntries := flag.Int("cache-entries", 0, "maximum number of cached elevation maps (0 for unlimited)")
+	cacheTTL := flag.Duration("cache-ttl", 5*time.Minute, "time to live of cached elevation maps (0 to keep them until evicted)")
+	tileCacheSize := flag.Int64("tile-cache-size", 256, "maximum memory of the rendered tile cache in MB (0 to disable)")
+	tileCacheDir := flag.String("tile-cache-dir", "", "directory of the persistent rendered tile cache (disabled if empty)")
+	tileCacheDirSize := flag.Int64("tile-cache-dir-size", 10240, "maximum size of the persistent rendered tile cache in MB (0 for unlimited)")
+	httpMaxAge := flag.Duration("http-max-age", 24*time.Hour, "max-age of the Cache-Control header of tiles")
+	hillshadeOptions := colors.DefaultHillshadeOptions()
+	flag.StringVar(&hillshadeOptions.Method, "hillshade-method", hillshadeOptions.Method, "slope method of the hillshade, horn or zevenbergen-thorne")
+	flag.Float64Var(&hillshadeOptions.Azimuth, "hillshade-azimuth", hillshadeOptions.Azimuth, "direction of the sun in degrees clockwise from north")
+	flag.Float64Var(&hillshadeOptions.Altitude, "hillshade-altitude", hillshadeOptions.Altitude, "angle of the sun above the horizon in degrees")
+	flag.Float64Var(&hillshadeOptions.ZFactor, "hillshade-z-factor", hillshadeOptions.ZFactor, "vertical exaggeration of the hillshade")
+	flag.Float64Var(&hillshadeOptions.Strength, "hillshade-strength", hillshadeOptions.Strength, "opacity of the hillshade in the shaded themes (0 to 1)")
+	tileBuffer := flag.Int("tile-buffer", 8, "pixels taken from the neighbor tiles, so smoothing and hillshade are seamless across tiles (0 to disable)")
+	themesDir := flag.String("themes", "", "directory of theme files (.json, .yaml) to serve in addition to the built-in themes")
+	flag.Parse()
+
+	terrain.ConfigureElevationCache(*cacheSize<<20, *cacheEntries, *cacheTTL)
+
+	if *diskCacheDir != "" {
+		if err := terrain.ConfigureDiskCache(*diskCacheDir, *diskCacheSize<<20, *diskCacheMaxAge); err != nil {
+			log.Fatalf("Failed to configure disk cache: %v", err)
+		}
+	}
+
+	source, err := terrain.NewElevationSource(*sourceSpec)
+	if err != nil {
+		log.Fatalf("Failed to configure elevation source: %v", err)
+	}
+
+	var tileDiskCache *terrain.DiskCache
+	if *tileCacheDir != "" {
+		tileDiskCache, err = terrain.NewDiskCache(*tileCacheDir, *tileCacheDirSize<<20, 0)
+		if err != nil {
+			log.Fatalf("Failed to configure tile cache: %v", err)
+		}
+	}
+	// The source spec is part of the keys, so changing the source doesn't serve stale tiles
+	tileCache := NewTileCache(fmt.Sprintf("%s|buffer=%d", *sourceSpec, *tileBuffer), *tileCacheSize<<20, tileDiskCache)
+
+	var themes []colors.ColorProvider
+	if *themesDir != "" {
+		themes, err = theme.LoadThemes(*themesDir, hillshadeOptions)
+		if err != nil {
+			log.Fatalf("Failed to load themes: %v", err)
+		}
+		log.Printf("Loaded %d themes from %s", len(themes), *themesDir)
+	}
+
 	geoCoverage, err := terrain.LoadGeoCoverage()
 	if err != nil {
 		log.Fatalf("Failed to load geo coverage: %v", err)
 	}
 
+	log.Printf("Using elevation source %s (zoom %d-%d, tile size %d)", source.Name(), source.MinZoom(), source.MaxZoom(), source.TileSize())
 	log.Printf("Starting terrain tile server on %s", addr)
 	log.Printf("Tiles Server Format: http://127.0.0.1%s/{theme}/{z}/{y}/{x}.{fileType}", addr)
 
 	if err := http.ListenAndServe(
 		addr,
 		handlers.CompressHandlerLevel(
-			MainHandler(geoCoverage),
+			MainHandler(geoCoverage, source, HandlerConfig{
+				TileCache: tileCache,
+				MaxAge:    *httpMaxAge,
+				Hillshade: hillshadeOptions,
+				Buffer:    *tileBuffer,
+				Themes:    themes,
+			}),
 			zlib.BestCompression),
 	); err != nil {
 		log.Fatalf("Server failed: %v", err)
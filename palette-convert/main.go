@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/colors/theme"
+)
+
+func main() {
+	to := flag.String("to", "gdal", "output format: gdal, cpt or qgis")
+	paletteName := flag.String("palette", "normal", "palette to export, if the input is a theme file")
+	minElevation := flag.Float64("min", float64(colors.DefaultPaletteRange.Min), "elevation of 0% / the start of relative palettes")
+	maxElevation := flag.Float64("max", float64(colors.DefaultPaletteRange.Max), "elevation of 100% / the end of relative palettes")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: palette-convert [flags] <palette.txt|.cpt|.qml|.xml|theme.yaml|theme.json>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputPath := flag.Arg(0)
+
+	var palette colors.ColorPalette
+	var err error
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".json", ".yaml", ".yml":
+		var config theme.Config
+		if _, config, err = theme.LoadThemeFile(inputPath); err == nil {
+			palette, err = config.Palette(*paletteName)
+		}
+	default:
+		palette, err = colors.LoadPaletteFile(inputPath, colors.PaletteRange{Min: float32(*minElevation), Max: float32(*maxElevation)})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := colors.WritePalette(os.Stdout, palette, colors.PaletteFormat(*to)); err != nil {
+		log.Fatal(err)
+	}
+}
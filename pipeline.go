@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+)
+
+// ElevationStage is a post-processing step, modifying the elevation map of a tile in place
+type ElevationStage interface {
+	// Name identifies the stage in errors
+	Name() string
+	// Process applies the stage to the elevation map (including its buffer)
+	Process(ctx context.Context, elevationMap *terrain.ElevationMap, tile *terrain.TileBounds) error
+}
+
+// ElevationPipeline is the ordered list of stages applied between fetching the elevation and creating the cells
+type ElevationPipeline []ElevationStage
+
+// NewElevationPipeline creates the pipeline of the enabled stages in the options
+func NewElevationPipeline(options colors.ElevationOptions, geoCoverage *terrain.GeoCoverage) ElevationPipeline {
+	var pipeline ElevationPipeline
+	if options.Fix != nil {
+		pipeline = append(pipeline, &fixElevationStage{options: *options.Fix, geoCoverage: geoCoverage})
+	}
+	if options.Coastlines != nil {
+		pipeline = append(pipeline, &coastlineStage{options: *options.Coastlines})
+	}
+	return pipeline
+}
+
+// Process applies all stages in order
+func (p ElevationPipeline) Process(ctx context.Context, elevationMap *terrain.ElevationMap, tile *terrain.TileBounds) error {
+	for _, stage := range p {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := stage.Process(ctx, elevationMap, tile); err != nil {
+			return fmt.Errorf("elevation stage %s: %w", stage.Name(), err)
+		}
+	}
+	return nil
+}
+
+// fixElevationStage corrects the elevation of sea areas with wrong source data (see fixElevationMap)
+type fixElevationStage struct {
+	options     colors.FixElevationOptions
+	geoCoverage *terrain.GeoCoverage
+}
+
+func (s *fixElevationStage) Name() string {
+	return "fix"
+}
+
+func (s *fixElevationStage) Process(ctx context.Context, elevationMap *terrain.ElevationMap, tile *terrain.TileBounds) error {
+	if tile.Zoom > s.options.MaxZoom {
+		return nil
+	}
+	fixElevationMap(elevationMap, tile, s.geoCoverage)
+	return nil
+}
+
+// coastlineStage smooths the elevation along coastlines (see smoothCoastlines)
+type coastlineStage struct {
+	options colors.CoastlineOptions
+}
+
+func (s *coastlineStage) Name() string {
+	return "coastlines"
+}
+
+func (s *coastlineStage) Process(ctx context.Context, elevationMap *terrain.ElevationMap, tile *terrain.TileBounds) error {
+	if tile.Zoom < s.options.MinZoom || tile.Zoom > s.options.MaxZoom {
+		return nil
+	}
+	radius := s.options.RadiusForZoom(tile.Zoom)
+
+	// Smooth into a new grid, so every pixel sees the original neighborhood
+	result := make([][]float32, len(elevationMap.Data))
+	for row, values := range elevationMap.Data {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		result[row] = make([]float32, len(values))
+		y := row - elevationMap.Buffer
+		for col, elevation := range values {
+			result[row][col] = smoothCoastlines(elevation, col-elevationMap.Buffer, y, elevationMap, radius, s.options.MixFactor)
+		}
+	}
+
+	elevationMap.Data = result
+	return nil
+}
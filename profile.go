@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+)
+
+const (
+	// profileMaxVertices is the max number of vertices of the line
+	profileMaxVertices = 10000
+	// profileMaxSamples is the max number of samples of a profile, smaller spacings are rejected
+	profileMaxSamples = 10000
+	// profileMinSpacing is the smallest sample spacing in meters
+	profileMinSpacing = 1
+	// profileDefaultPrecision is the precision of encoded polylines (5 as Google, OSRM and Valhalla use 6)
+	profileDefaultPrecision = 5
+)
+
+// profileRequest is the body of a profile request, with either the line as GeoJSON (LineString geometry or
+// feature) or as encoded polyline. Spacing (meters) and Zoom are optional.
+type profileRequest struct {
+	Line      json.RawMessage `json:"line,omitempty"`
+	Polyline  string          `json:"polyline,omitempty"`
+	Precision *int            `json:"precision,omitempty"`
+	Spacing   float64         `json:"spacing,omitempty"`
+	Zoom      *uint32         `json:"z,omitempty"`
+}
+
+// elevationProfile is the elevation along a line, Profile has the distance (meters from the start) and elevation
+// of each sample
+type elevationProfile struct {
+	Distance     float64      `json:"distance"`
+	Ascent       float64      `json:"ascent"`
+	Descent      float64      `json:"descent"`
+	MinElevation float64      `json:"minElevation"`
+	MaxElevation float64      `json:"maxElevation"`
+	Spacing      float64      `json:"spacing"`
+	Zoom         uint32       `json:"zoom"`
+	Profile      [][2]float64 `json:"profile"`
+}
+
+// configureProfileHandler serves elevation profiles along a line, for an encoded polyline
+// (GET /profile?polyline=..&spacing=..&z=..) or a GeoJSON line (POST /profile with a profileRequest body)
+func configureProfileHandler(geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	pipeline := NewElevationPipeline(colors.DefaultElevationOptions(), geoCoverage)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var request profileRequest
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			request.Polyline = query.Get("polyline")
+			if query.Has("precision") {
+				precision, err := strconv.Atoi(query.Get("precision"))
+				if err != nil {
+					http.Error(w, "Invalid precision parameter", http.StatusBadRequest)
+					return
+				}
+				request.Precision = &precision
+			}
+			if query.Has("spacing") {
+				spacing, err := strconv.ParseFloat(query.Get("spacing"), 64)
+				if err != nil {
+					http.Error(w, "Invalid spacing parameter", http.StatusBadRequest)
+					return
+				}
+				request.Spacing = spacing
+			}
+			if query.Has("z") {
+				zoom, err := strconv.ParseUint(query.Get("z"), 10, 32)
+				if err != nil {
+					http.Error(w, "Invalid z parameter", http.StatusBadRequest)
+					return
+				}
+				z := uint32(zoom)
+				request.Zoom = &z
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, elevationMaxBodyBytes)).Decode(&request); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		line, err := request.lineString()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zoom := source.MaxZoom()
+		if request.Zoom != nil {
+			zoom = min(max(*request.Zoom, source.MinZoom()), source.MaxTileZoom())
+		}
+
+		// By default about a pixel of the zoom level at the equator, at most the resolution of the data
+		spacing := request.Spacing
+		if spacing == 0 {
+			spacing = max(profileDefaultSpacing(source, zoom), profileMinSpacing)
+		}
+		if !(spacing >= profileMinSpacing) {
+			http.Error(w, fmt.Sprintf("Invalid spacing %v, at least %d meters are allowed", spacing, profileMinSpacing), http.StatusBadRequest)
+			return
+		}
+		if samples := geo.LengthHaversine(line)/spacing + 2; samples > profileMaxSamples {
+			http.Error(w, fmt.Sprintf("Spacing %v is too small for the line, at most %d samples are allowed", spacing, profileMaxSamples), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		defer cancel()
+
+		log.Printf("%s /profile %d vertices (spacing %.1fm, zoom %d)", r.Method, len(line), spacing, zoom)
+		defer func() {
+			log.Printf("%s /profile %d vertices (spacing %.1fm, zoom %d) - %s", r.Method, len(line), spacing, zoom, time.Since(start).Round(time.Millisecond))
+		}()
+
+		profile, err := sampleElevationProfile(ctx, NewElevationSampler(source, pipeline, zoom), line, spacing)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		json.NewEncoder(w).Encode(profile)
+	}
+}
+
+// profileDefaultSpacing returns the size in meters at the equator of a pixel of the source maps at the zoom level,
+// maps above the max zoom of the source are interpolated and have no finer resolution
+func profileDefaultSpacing(source terrain.ElevationSource, zoom uint32) float64 {
+	pixels := math.Exp2(float64(min(zoom, source.MaxZoom()))) * float64(source.TileSize())
+	return 2 * math.Pi * orb.EarthRadius / pixels
+}
+
+// lineString returns the validated line of the request
+func (r profileRequest) lineString() (orb.LineString, error) {
+	var line orb.LineString
+	switch {
+	case len(r.Line) > 0 && r.Polyline != "":
+		return nil, errors.New("Either line or polyline is allowed, not both")
+	case len(r.Line) > 0:
+		var err error
+		if line, err = parseGeoJSONLine(r.Line); err != nil {
+			return nil, err
+		}
+	case r.Polyline != "":
+		precision := profileDefaultPrecision
+		if r.Precision != nil {
+			precision = *r.Precision
+		}
+		if precision < 1 || precision > 7 {
+			return nil, fmt.Errorf("Invalid polyline precision %d", precision)
+		}
+		var err error
+		if line, err = decodePolyline(r.Polyline, precision); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Missing line or polyline")
+	}
+
+	if len(line) < 2 || len(line) > profileMaxVertices {
+		return nil, fmt.Errorf("The line must have between 2 and %d vertices", profileMaxVertices)
+	}
+	for _, point := range line {
+		if err := validateLocation(point.Lat(), point.Lon()); err != nil {
+			return nil, err
+		}
+	}
+	return line, nil
+}
+
+// parseGeoJSONLine parses a LineString geometry, or a feature with a LineString geometry
+func parseGeoJSONLine(data []byte) (orb.LineString, error) {
+	var geometry orb.Geometry
+	if feature, err := geojson.UnmarshalFeature(data); err == nil && feature.Type == "Feature" {
+		geometry = feature.Geometry
+	} else if g, err := geojson.UnmarshalGeometry(data); err == nil {
+		geometry = g.Geometry()
+	}
+
+	line, ok := geometry.(orb.LineString)
+	if !ok {
+		return nil, errors.New("Invalid line, expected a GeoJSON LineString")
+	}
+	return line, nil
+}
+
+// decodePolyline decodes an encoded polyline (https://developers.google.com/maps/documentation/utilities/polylinealgorithm)
+// with the number of decimals of the coordinates
+func decodePolyline(encoded string, precision int) (orb.LineString, error) {
+	factor := math.Pow10(precision)
+
+	var line orb.LineString
+	var lat, lng int64
+	for i := 0; i < len(encoded); {
+		var deltas [2]int64
+		for j := range deltas {
+			var result int64
+			for shift := uint(0); ; shift += 5 {
+				if i >= len(encoded) || shift > 60 {
+					return nil, errors.New("Invalid polyline")
+				}
+				b := int64(encoded[i]) - 63
+				i++
+				if b < 0 || b > 0x3f {
+					return nil, errors.New("Invalid polyline")
+				}
+				result |= (b & 0x1f) << shift
+				if b < 0x20 {
+					break
+				}
+			}
+			deltas[j] = (result >> 1) ^ -(result & 1)
+		}
+
+		lat += deltas[0]
+		lng += deltas[1]
+		line = append(line, orb.Point{float64(lng) / factor, float64(lat) / factor})
+	}
+	return line, nil
+}
+
+// sampleElevationProfile samples the elevation along the great circles between the vertices of the line, every
+// spacing meters and at the end of the line
+func sampleElevationProfile(ctx context.Context, sampler *ElevationSampler, line orb.LineString, spacing float64) (*elevationProfile, error) {
+	profile := &elevationProfile{
+		MinElevation: math.Inf(1),
+		MaxElevation: math.Inf(-1),
+		Spacing:      spacing,
+		Zoom:         sampler.Zoom(),
+	}
+
+	add := func(distance float64, point orb.Point) error {
+		elevation, err := sampler.Elevation(ctx, point.Lat(), point.Lon())
+		if err != nil {
+			return errors.New("Failed to get source data for line")
+		}
+
+		sample := [2]float64{roundCentimeters(distance), roundCentimeters(float64(elevation))}
+		if n := len(profile.Profile); n > 0 {
+			if change := sample[1] - profile.Profile[n-1][1]; change > 0 {
+				profile.Ascent += change
+			} else {
+				profile.Descent -= change
+			}
+		}
+		profile.MinElevation = min(profile.MinElevation, sample[1])
+		profile.MaxElevation = max(profile.MaxElevation, sample[1])
+		profile.Profile = append(profile.Profile, sample)
+		return nil
+	}
+
+	// The distance of the next sample from the start of the line
+	next := 0.0
+	for i := 0; i+1 < len(line); i++ {
+		from, to := line[i], line[i+1]
+		length := geo.DistanceHaversine(from, to)
+		bearing := geo.Bearing(from, to)
+
+		for ; next < profile.Distance+length; next += spacing {
+			point := geo.PointAtBearingAndDistance(from, bearing, next-profile.Distance)
+			if err := add(next, point); err != nil {
+				return nil, err
+			}
+		}
+		profile.Distance += length
+	}
+
+	// The end of the line, unless it is a sample already
+	if n := len(profile.Profile); n == 0 || profile.Profile[n-1][0] < roundCentimeters(profile.Distance) {
+		if err := add(profile.Distance, line[len(line)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	profile.Distance = roundCentimeters(profile.Distance)
+	profile.Ascent = roundCentimeters(profile.Ascent)
+	profile.Descent = roundCentimeters(profile.Descent)
+	return profile, nil
+}
+
+func roundCentimeters(meters float64) float64 {
+	return math.Round(meters*100) / 100
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	// The example of the polyline algorithm documentation
+	const encoded = "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+	want := orb.LineString{{-120.2, 38.5}, {-120.95, 40.7}, {-126.453, 43.252}}
+
+	for _, precision := range []int{5, 6} {
+		line, err := decodePolyline(encoded, precision)
+		if err != nil {
+			t.Fatalf("precision %d: %v", precision, err)
+		}
+		if len(line) != len(want) {
+			t.Fatalf("precision %d: got %d points, want %d", precision, len(line), len(want))
+		}
+
+		// The same integers are 10 times smaller with 6 decimals
+		scale := math.Pow10(5 - precision)
+		for i, point := range line {
+			if math.Abs(point.Lon()-want[i].Lon()*scale) > 1e-9 || math.Abs(point.Lat()-want[i].Lat()*scale) > 1e-9 {
+				t.Errorf("precision %d: got point %v, want %v", precision, point, orb.Point{want[i].Lon() * scale, want[i].Lat() * scale})
+			}
+		}
+	}
+}
+
+func TestDecodePolylineInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		// Truncated within a value
+		"_p~iF~ps|U_ulLnnqC_mqNvxq`",
+		// Latitude without longitude
+		"_p~iF~ps|U_ulL",
+		// Characters outside of the encoding
+		"_p~iF ~ps|U",
+		"_p~iF~ps|U\x7f?",
+		"_p~iF~ps|Ué",
+		// Values beyond 64 bits
+		"~~~~~~~~~~~~~~??",
+	} {
+		if line, err := decodePolyline(encoded, 5); err == nil {
+			t.Errorf("%q: got %v, want an error", encoded, line)
+		}
+	}
+
+	line, err := decodePolyline("", 5)
+	if err != nil || len(line) != 0 {
+		t.Errorf("got %v (error %v) for an empty polyline, want no points", line, err)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+	"github.com/paulmach/orb"
+)
+
+const (
+	// quantizedMeshVersion invalidates the cached terrain tiles when their output changes
+	quantizedMeshVersion = "1"
+	// quantizedMeshMaxZoom is the highest level of the terrain tiles
+	quantizedMeshMaxZoom = 15
+	// quantizedMeshGridSize is the number of height samples per row and column of a tile (2^n+1)
+	quantizedMeshGridSize = 65
+	// quantizedMeshLevelZeroError is the geometric error of level 0, as Cesium calculates it for tiles with
+	// 65 samples per row and 2 tiles at level 0
+	quantizedMeshLevelZeroError = 2 * math.Pi * 6378137.0 * 0.25 / (quantizedMeshGridSize * 2)
+
+	quantizedMeshNormalsExtension   = "octvertexnormals"
+	quantizedMeshWaterMaskExtension = "watermask"
+)
+
+// quantizedMeshMaxError is the max height error of the simplified mesh of a level in meters, a quarter of the
+// geometric error Cesium assumes for the level
+func quantizedMeshMaxError(z uint32) float32 {
+	return float32(quantizedMeshLevelZeroError / math.Exp2(float64(z)) / 4)
+}
+
+// geographicTileBound returns the bounds of a tile of the geographic tiling scheme (EPSG:4326, 2 tiles at
+// level 0, y counted from the south as in TMS)
+func geographicTileBound(z, x, y uint32) orb.Bound {
+	size := 180 / math.Exp2(float64(z))
+	return orb.Bound{
+		Min: orb.Point{-180 + float64(x)*size, -90 + float64(y)*size},
+		Max: orb.Point{-180 + float64(x+1)*size, -90 + float64(y+1)*size},
+	}
+}
+
+// configureQuantizedMeshHandlers serves the terrain for Cesium as quantized-mesh-1.0 tiles in the geographic
+// tiling scheme, with the layer.json describing them
+func configureQuantizedMeshHandlers(router *mux.Router, geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	tileCache := config.TileCache
+	options := colors.DefaultElevationOptions()
+	pipeline := NewElevationPipeline(options, geoCoverage)
+
+	layer, err := json.Marshal(newQuantizedMeshLayer())
+	if err != nil {
+		log.Fatalf("Failed to create layer.json: %v", err)
+	}
+
+	router.HandleFunc("/quantized-mesh/layer.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(layer))
+	})
+
+	router.HandleFunc("/quantized-mesh/{z:[1-2]?[0-9]}/{y:[0-9]+}/{x:[0-9]+}.terrain", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		z, x, y, err := parseTileCoordColumns(mux.Vars(r), quantizedMeshMaxZoom, 2)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		defer cancel()
+
+		extensions := acceptedQuantizedMeshExtensions(r.Header.Get("Accept"))
+
+		log.Printf("/quantized-mesh/%d/%d/%d.terrain %v", z, y, x, extensions)
+		defer func() {
+			log.Printf("/quantized-mesh/%d/%d/%d.terrain %v - %s", z, y, x, extensions, time.Since(start).Round(time.Millisecond))
+		}()
+
+		contentType := "application/vnd.quantized-mesh"
+		if len(extensions) > 0 {
+			contentType += ";extensions=" + strings.Join(extensions, "-")
+		}
+		w.Header().Add("Vary", "Accept")
+
+		key := tileCache.key("quantized-mesh", quantizedMeshVersion+"+"+strings.Join(extensions, "-"), options, z, x, y, "terrain")
+		serveTile(ctx, w, r, tileCache, key, cacheControl, contentType, func(ctx context.Context) ([]byte, error) {
+			sampler := NewElevationSampler(source, pipeline, quantizedMeshSourceZoom(source, z))
+			return renderQuantizedMesh(ctx, geoCoverage, sampler, z, x, y, extensions)
+		})
+	})
+}
+
+// quantizedMeshLayer is the layer.json of the terrain tiles
+type quantizedMeshLayer struct {
+	TileJSON   string                     `json:"tilejson"`
+	Name       string                     `json:"name"`
+	Version    string                     `json:"version"`
+	Format     string                     `json:"format"`
+	Scheme     string                     `json:"scheme"`
+	Projection string                     `json:"projection"`
+	Tiles      []string                   `json:"tiles"`
+	MinZoom    uint32                     `json:"minzoom"`
+	MaxZoom    uint32                     `json:"maxzoom"`
+	Bounds     [4]float64                 `json:"bounds"`
+	Extensions []string                   `json:"extensions"`
+	Available  [][]quantizedMeshTileRange `json:"available"`
+}
+
+// quantizedMeshTileRange is a range of available tiles of a level
+type quantizedMeshTileRange struct {
+	StartX uint32 `json:"startX"`
+	StartY uint32 `json:"startY"`
+	EndX   uint32 `json:"endX"`
+	EndY   uint32 `json:"endY"`
+}
+
+func newQuantizedMeshLayer() quantizedMeshLayer {
+	layer := quantizedMeshLayer{
+		TileJSON:   "2.1.0",
+		Name:       "colorful-terrarium",
+		Version:    "1.0." + quantizedMeshVersion,
+		Format:     "quantized-mesh-1.0",
+		Scheme:     "tms",
+		Projection: "EPSG:4326",
+		Tiles:      []string{"{z}/{y}/{x}.terrain?v={version}"},
+		MinZoom:    0,
+		MaxZoom:    quantizedMeshMaxZoom,
+		Bounds:     [4]float64{-180, -90, 180, 90},
+		Extensions: []string{quantizedMeshNormalsExtension, quantizedMeshWaterMaskExtension},
+	}
+
+	// All tiles of all levels are available
+	for z := uint32(0); z <= quantizedMeshMaxZoom; z++ {
+		rows := uint32(1) << z
+		layer.Available = append(layer.Available, []quantizedMeshTileRange{{EndX: 2*rows - 1, EndY: rows - 1}})
+	}
+	return layer
+}
+
+// acceptedQuantizedMeshExtensions returns the supported extensions requested in the Accept header, e.g.
+// "application/vnd.quantized-mesh;extensions=octvertexnormals-watermask"
+func acceptedQuantizedMeshExtensions(accept string) []string {
+	var requested []string
+	for _, mediaRange := range strings.Split(accept, ",") {
+		for _, parameter := range strings.Split(mediaRange, ";")[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(parameter), "="); ok && name == "extensions" {
+				requested = append(requested, strings.Split(value, "-")...)
+			}
+		}
+	}
+
+	// In a fixed order, so equal requests share the cached tile
+	var extensions []string
+	for _, extension := range []string{quantizedMeshNormalsExtension, quantizedMeshWaterMaskExtension} {
+		for _, name := range requested {
+			if name == extension {
+				extensions = append(extensions, extension)
+				break
+			}
+		}
+	}
+	return extensions
+}
+
+// quantizedMeshSourceZoom returns the zoom level of the source tiles with at least the resolution of the mesh
+func quantizedMeshSourceZoom(source terrain.ElevationSource, z uint32) uint32 {
+	// A tile of the level has (grid size - 1) * 2^(z+1) cells around the equator
+	cells := float64(quantizedMeshGridSize-1) * math.Exp2(float64(z+1))
+	zoom := int(math.Ceil(math.Log2(cells / float64(source.TileSize()))))
+	return uint32(min(max(zoom, int(source.MinZoom())), int(source.MaxZoom())))
+}
+
+// renderQuantizedMesh samples the elevation of the tile on a grid, simplifies it and encodes it with the
+// requested extensions. Water is at sea level, as Cesium renders the water on the terrain surface.
+func renderQuantizedMesh(ctx context.Context, geoCoverage *terrain.GeoCoverage, sampler *ElevationSampler, z, x, y uint32, extensions []string) ([]byte, error) {
+	bound := geographicTileBound(z, x, y)
+	width, height := bound.Max[0]-bound.Min[0], bound.Max[1]-bound.Min[1]
+
+	// Rows from north to south
+	cells := quantizedMeshGridSize - 1
+	heights := make([]float32, quantizedMeshGridSize*quantizedMeshGridSize)
+	for row := 0; row < quantizedMeshGridSize; row++ {
+		lat := bound.Max[1] - float64(row)/float64(cells)*height
+		for col := 0; col < quantizedMeshGridSize; col++ {
+			lng := bound.Min[0] + float64(col)/float64(cells)*width
+
+			elevation, err := sampler.Elevation(ctx, lat, lng)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, errors.New("Failed to get source data for tile")
+			}
+			if elevation < 0 && !isLand(elevation, lng, lat, geoCoverage) {
+				elevation = 0
+			}
+			heights[row*quantizedMeshGridSize+col] = elevation
+		}
+	}
+
+	grid, err := terrain.TriangulateGrid(heights, quantizedMeshGridSize, quantizedMeshMaxError(z))
+	if err != nil {
+		return nil, err
+	}
+
+	mesh := &terrain.QuantizedMesh{Bound: bound, Triangles: grid.Triangles}
+	for _, vertex := range grid.Vertices {
+		mesh.Vertices = append(mesh.Vertices, terrain.MeshVertex{
+			U:      float64(vertex[0]) / float64(cells),
+			V:      1 - float64(vertex[1])/float64(cells),
+			Height: float64(heights[vertex[1]*quantizedMeshGridSize+vertex[0]]),
+		})
+	}
+
+	for _, extension := range extensions {
+		switch extension {
+		case quantizedMeshNormalsExtension:
+			mesh.Normals = true
+		case quantizedMeshWaterMaskExtension:
+			if mesh.WaterMask, err = quantizedMeshWaterMask(ctx, geoCoverage, sampler, bound); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, errors.New("Failed to get source data for water mask")
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := mesh.Encode(&buf); err != nil {
+		return nil, errors.New("Failed to encode terrain tile")
+	}
+	return buf.Bytes(), nil
+}
+
+// quantizedMeshWaterMask classifies the pixels of the mask like the cells of the color themes (255 is water),
+// a mask with only land or only water is a single byte
+func quantizedMeshWaterMask(ctx context.Context, geoCoverage *terrain.GeoCoverage, sampler *ElevationSampler, bound orb.Bound) ([]byte, error) {
+	size := terrain.QuantizedMeshWaterMaskSize
+	width, height := bound.Max[0]-bound.Min[0], bound.Max[1]-bound.Min[1]
+
+	mask := make([]byte, size*size)
+	water := 0
+	for row := 0; row < size; row++ {
+		lat := bound.Max[1] - (float64(row)+0.5)/float64(size)*height
+		for col := 0; col < size; col++ {
+			lng := bound.Min[0] + (float64(col)+0.5)/float64(size)*width
+
+			elevation, err := sampler.Elevation(ctx, lat, lng)
+			if err != nil {
+				return nil, err
+			}
+			if !isLand(elevation, lng, lat, geoCoverage) {
+				mask[row*size+col] = 255
+				water++
+			}
+		}
+	}
+
+	switch water {
+	case 0:
+		return []byte{0}, nil
+	case len(mask):
+		return []byte{255}, nil
+	}
+	return mask, nil
+}
@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestQuantizedMeshSourceZoom(t *testing.T) {
+	// The 64 cells of a mesh need 2^(z+7) pixels around the equator, the maps have 512 pixels
+	source := gradientSource{}
+	for _, test := range []struct{ z, zoom uint32 }{{0, 0}, {2, 0}, {3, 1}, {12, 10}, {15, 13}, {16, 14}, {20, 14}} {
+		if zoom := quantizedMeshSourceZoom(source, test.z); zoom != test.zoom {
+			t.Errorf("level %d: got source zoom %d, want %d", test.z, zoom, test.zoom)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/mxzinke/colorful-terrarium/terrain"
+)
+
+// maxMercatorLatitude is the latitude limit of the web mercator tiles, samples beyond use the edge
+const maxMercatorLatitude = 85.0511
+
+// ElevationSampler samples the post-processed elevation at geographic locations from the tiles of a zoom
+// level. Each tile is fetched and processed once per sampler, so a sampler should be used per request.
+type ElevationSampler struct {
+	source   terrain.ElevationSource
+	pipeline ElevationPipeline
+	zoom     uint32
+
+	mu    sync.Mutex
+	tiles map[terrain.TileCoord]*sampledTile
+}
+
+// sampledTile is a processed tile of the sampler, with a buffer of one pixel for the interpolation at its edges
+type sampledTile struct {
+	once         sync.Once
+	elevationMap *terrain.ElevationMap
+	err          error
+}
+
+// NewElevationSampler creates a sampler of the source tiles at the zoom level, processed by the pipeline
+func NewElevationSampler(source terrain.ElevationSource, pipeline ElevationPipeline, zoom uint32) *ElevationSampler {
+	return &ElevationSampler{
+		source:   source,
+		pipeline: pipeline,
+		zoom:     zoom,
+		tiles:    make(map[terrain.TileCoord]*sampledTile),
+	}
+}
+
+// Zoom returns the zoom level of the sampled tiles
+func (s *ElevationSampler) Zoom() uint32 {
+	return s.zoom
+}
+
+// Elevation returns the elevation at the location, interpolated bilinearly between the centers of the pixels
+func (s *ElevationSampler) Elevation(ctx context.Context, lat, lng float64) (float32, error) {
+	// The tile containing the location, its neighbor pixels can be in the buffer
+	tileCount := int64(1) << s.zoom
+	tx, ty := mercatorPixel(lng, lat, s.zoom, 1)
+	tileX := int64(math.Floor(tx))
+	tileY := min(max(int64(math.Floor(ty)), 0), tileCount-1)
+
+	elevationMap, err := s.tile(ctx, terrain.TileCoord{Z: s.zoom, X: uint32((tileX%tileCount + tileCount) % tileCount), Y: uint32(tileY)})
+	if err != nil {
+		return 0, err
+	}
+
+	// Pixel coordinates of the location within the tile, relative to the pixel centers
+	tileSize := float64(elevationMap.TileSize)
+	x := (tx-float64(tileX))*tileSize - 0.5
+	y := (ty-float64(tileY))*tileSize - 0.5
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := float32(x-x0), float32(y-y0)
+	px, py := int(x0), int(y0)
+
+	top := elevationMap.GetElevation(px, py)*(1-fx) + elevationMap.GetElevation(px+1, py)*fx
+	bottom := elevationMap.GetElevation(px, py+1)*(1-fx) + elevationMap.GetElevation(px+1, py+1)*fx
+	return top*(1-fy) + bottom*fy, nil
+}
+
+// tile returns the processed elevation map of the tile, fetching it on first use
+func (s *ElevationSampler) tile(ctx context.Context, coord terrain.TileCoord) (*terrain.ElevationMap, error) {
+	s.mu.Lock()
+	tile, ok := s.tiles[coord]
+	if !ok {
+		tile = &sampledTile{}
+		s.tiles[coord] = tile
+	}
+	s.mu.Unlock()
+
+	tile.once.Do(func() {
+		elevationMap, err := terrain.GetBufferedElevationMap(ctx, s.source, coord, 1)
+		if err != nil {
+			tile.err = err
+			return
+		}
+		bounds := terrain.CreateTileBounds(coord.Z, coord.Y, coord.X, elevationMap.TileSize)
+		if err := s.pipeline.Process(ctx, elevationMap, bounds); err != nil {
+			tile.err = err
+			return
+		}
+		tile.elevationMap = elevationMap
+	})
+	return tile.elevationMap, tile.err
+}
+
+// mercatorPixel returns the global pixel coordinates of the location at the zoom level, beyond the latitude limit
+// of the tiles the edge is used
+func mercatorPixel(lng, lat float64, zoom uint32, tileSize int) (x, y float64) {
+	scale := math.Exp2(float64(zoom)) * float64(tileSize)
+	lat = math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, lat))
+	latRad := lat * math.Pi / 180
+	x = (lng + 180) / 360 * scale
+	y = (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * scale
+	return x, y
+}
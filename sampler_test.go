@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/mxzinke/colorful-terrarium/terrain"
+)
+
+// gradientSource returns maps of 512 pixels with the global pixel column (x) plus 1000 times the global pixel
+// row (y) as elevation, like the maps composed of 4 subtiles of 256 pixels
+type gradientSource struct{}
+
+func (gradientSource) Name() string        { return "gradient" }
+func (gradientSource) MinZoom() uint32     { return 0 }
+func (gradientSource) MaxZoom() uint32     { return 14 }
+func (gradientSource) MaxTileZoom() uint32 { return 14 }
+func (gradientSource) TileSize() int       { return 512 }
+
+func (s gradientSource) GetElevationMap(ctx context.Context, coord terrain.TileCoord) (*terrain.ElevationMap, error) {
+	data := make([][]float32, s.TileSize())
+	for y := range data {
+		data[y] = make([]float32, s.TileSize())
+		for x := range data[y] {
+			data[y][x] = float32(int(coord.X)*s.TileSize()+x) + 1000*float32(int(coord.Y)*s.TileSize()+y)
+		}
+	}
+	return &terrain.ElevationMap{Data: data, TileSize: s.TileSize()}, nil
+}
+
+func TestElevationSamplerPixelCenters(t *testing.T) {
+	const zoom = 2
+	source := gradientSource{}
+	sampler := NewElevationSampler(source, nil, zoom)
+	worldSize := float64(source.TileSize()) * math.Exp2(zoom)
+
+	// Pixel centers within tiles, at the tile edges and half way between two tiles
+	for _, pixel := range [][2]float64{{10.5, 20.5}, {511.5, 700.5}, {512, 1023.5}, {1000.25, 1536}, {2047.5, 1200.5}} {
+		lng := pixel[0]/worldSize*360 - 180
+		lat := math.Atan(math.Sinh(math.Pi*(1-2*pixel[1]/worldSize))) * 180 / math.Pi
+
+		elevation, err := sampler.Elevation(context.Background(), lat, lng)
+		if err != nil {
+			t.Fatalf("pixel %v: %v", pixel, err)
+		}
+
+		want := (pixel[0] - 0.5) + 1000*(pixel[1]-0.5)
+		if math.Abs(float64(elevation)-want) > 0.5 {
+			t.Errorf("pixel %v: got elevation %v, want %v", pixel, elevation, want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+	"github.com/paulmach/orb"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// staticMapMaxSize is the max width and height of a static map in pixels
+	staticMapMaxSize = 4096
+	// staticMapMaxRenderSize is the max width and height of the stitched tiles, before the scaling to the output size
+	staticMapMaxRenderSize = 2 * staticMapMaxSize
+	// staticMapAttributionPadding is the space around the attribution text in pixels
+	staticMapAttributionPadding = 4
+)
+
+// staticMapRequest is a static map of the bounds, with the output size (either side is optional, the other one
+// follows from the aspect ratio of the bounds) and/or the zoom level of the tiles
+type staticMapRequest struct {
+	Bound       orb.Bound
+	Width       int
+	Height      int
+	Zoom        *uint32
+	Attribution string
+}
+
+// configureStaticMapHandler serves a single image of the provider for a bounding box
+// (/static/{name}.{ext}?bbox=minLon,minLat,maxLon,maxLat&width=..&height=..&z=..&attribution=..)
+func configureStaticMapHandler(provider colors.ColorProvider, encoder colors.ImageEncoder, geoCoverage *terrain.GeoCoverage, source terrain.ElevationSource, config HandlerConfig) http.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+	pipeline := NewElevationPipeline(colors.ProviderElevationOptions(provider), geoCoverage)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		request, err := parseStaticMapRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+		defer cancel()
+
+		log.Printf("/static/%s.%s %s", provider.Name(), encoder.Extension(), r.URL.RawQuery)
+		defer func() {
+			log.Printf("/static/%s.%s %s - %s", provider.Name(), encoder.Extension(), r.URL.RawQuery, time.Since(start).Round(time.Millisecond))
+		}()
+
+		img, err := renderStaticMap(ctx, provider, geoCoverage, pipeline, source, config.Buffer, request)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			var requestErr staticMapRequestError
+			if errors.As(err, &requestErr) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := encoder.Encode(&buf, img); err != nil {
+			http.Error(w, "Failed to encode image", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", cacheControl)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}
+}
+
+// staticMapRequestError is an invalid combination of the request parameters
+type staticMapRequestError string
+
+func (e staticMapRequestError) Error() string {
+	return string(e)
+}
+
+// parseStaticMapRequest parses the query parameters of a static map
+func parseStaticMapRequest(r *http.Request) (staticMapRequest, error) {
+	query := r.URL.Query()
+	var request staticMapRequest
+
+	values := strings.Split(query.Get("bbox"), ",")
+	if len(values) != 4 {
+		return request, errors.New("Invalid bbox parameter, expected minLon,minLat,maxLon,maxLat")
+	}
+	var bbox [4]float64
+	for i, value := range values {
+		var err error
+		if bbox[i], err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return request, errors.New("Invalid bbox parameter, expected minLon,minLat,maxLon,maxLat")
+		}
+	}
+	for _, corner := range [][2]float64{{bbox[0], bbox[1]}, {bbox[2], bbox[3]}} {
+		if err := validateLocation(corner[1], corner[0]); err != nil {
+			return request, err
+		}
+	}
+	if bbox[1] >= bbox[3] || bbox[0] == bbox[2] {
+		return request, errors.New("Invalid bbox parameter, the bbox is empty")
+	}
+	// A bbox with minLon > maxLon crosses the antimeridian
+	if bbox[0] > bbox[2] {
+		bbox[2] += 360
+	}
+	request.Bound = orb.Bound{Min: orb.Point{bbox[0], bbox[1]}, Max: orb.Point{bbox[2], bbox[3]}}
+
+	for name, size := range map[string]*int{"width": &request.Width, "height": &request.Height} {
+		if !query.Has(name) {
+			continue
+		}
+		value, err := strconv.Atoi(query.Get(name))
+		if err != nil || value < 1 || value > staticMapMaxSize {
+			return request, fmt.Errorf("Invalid %s parameter, expected 1 to %d pixels", name, staticMapMaxSize)
+		}
+		*size = value
+	}
+
+	if query.Has("z") {
+		zoom, err := strconv.ParseUint(query.Get("z"), 10, 32)
+		if err != nil || zoom > 29 {
+			return request, errors.New("Invalid z parameter")
+		}
+		z := uint32(zoom)
+		request.Zoom = &z
+	}
+
+	if request.Width == 0 && request.Height == 0 && request.Zoom == nil {
+		return request, errors.New("Missing width, height or z parameter")
+	}
+
+	request.Attribution = query.Get("attribution")
+	return request, nil
+}
+
+// renderStaticMap renders the tiles covering the bounds through the pipeline of the provider, stitches them and
+// scales them to the output size. The bounds are widened to the aspect ratio of the output size.
+func renderStaticMap(ctx context.Context, provider colors.ColorProvider, geoCoverage *terrain.GeoCoverage, pipeline ElevationPipeline, source terrain.ElevationSource, buffer int, request staticMapRequest) (image.Image, error) {
+	tileSize := source.TileSize()
+
+	// Bounds in pixels of zoom level 0
+	minX, minY := mercatorPixel(request.Bound.Min.Lon(), request.Bound.Max.Lat(), 0, tileSize)
+	maxX, maxY := mercatorPixel(request.Bound.Max.Lon(), request.Bound.Min.Lat(), 0, tileSize)
+	boundWidth, boundHeight := maxX-minX, maxY-minY
+	if boundHeight <= 0 {
+		return nil, staticMapRequestError("The bbox is beyond the latitude limits of the map")
+	}
+
+	width, height := request.Width, request.Height
+	switch {
+	case width == 0 && height == 0:
+		scale := math.Exp2(float64(*request.Zoom))
+		width, height = int(math.Round(boundWidth*scale)), int(math.Round(boundHeight*scale))
+	case width == 0:
+		width = int(math.Round(float64(height) * boundWidth / boundHeight))
+	case height == 0:
+		height = int(math.Round(float64(width) * boundHeight / boundWidth))
+	}
+	if width < 1 || height < 1 || width > staticMapMaxSize || height > staticMapMaxSize {
+		return nil, staticMapRequestError(fmt.Sprintf("The map would be %dx%d pixels, expected 1 to %d pixels per side", width, height, staticMapMaxSize))
+	}
+
+	// The zoom level with at least the resolution of the output, up to the max zoom of the provider and source
+	var zoom uint32
+	if request.Zoom != nil {
+		zoom = *request.Zoom
+	} else {
+		zoom = uint32(max(0, math.Ceil(math.Log2(max(float64(width)/boundWidth, float64(height)/boundHeight)))))
+	}
+	zoom = min(max(zoom, source.MinZoom()), provider.MaxZoom(), source.MaxTileZoom())
+
+	// The pixels to render at the zoom level, widened to the aspect ratio of the output
+	scale := math.Exp2(float64(zoom))
+	centerX, centerY := (minX+maxX)/2*scale, (minY+maxY)/2*scale
+	renderWidth, renderHeight := boundWidth*scale, boundHeight*scale
+	if renderWidth*float64(height) < renderHeight*float64(width) {
+		renderWidth = renderHeight * float64(width) / float64(height)
+	} else {
+		renderHeight = renderWidth * float64(height) / float64(width)
+	}
+	areaWidth, areaHeight := int(math.Ceil(renderWidth)), int(math.Ceil(renderHeight))
+	if math.Abs(renderWidth-float64(width)) < 1 && math.Abs(renderHeight-float64(height)) < 1 {
+		// The tiles have the resolution of the output, so they are not scaled
+		areaWidth, areaHeight = width, height
+	}
+	origin := image.Pt(int(math.Round(centerX-float64(areaWidth)/2)), int(math.Round(centerY-float64(areaHeight)/2)))
+	area := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(areaWidth, areaHeight))}
+	if area.Dx() > staticMapMaxRenderSize || area.Dy() > staticMapMaxRenderSize {
+		return nil, staticMapRequestError(fmt.Sprintf("The bbox is too large for zoom %d", zoom))
+	}
+
+	canvas, err := stitchTiles(ctx, provider, geoCoverage, pipeline, source, buffer, zoom, area)
+	if err != nil {
+		return nil, err
+	}
+
+	output := canvas
+	if area.Dx() != width || area.Dy() != height {
+		output = image.NewNRGBA(image.Rect(0, 0, width, height))
+		staticMapScaler(provider).Scale(output, output.Bounds(), canvas, canvas.Bounds(), draw.Src, nil)
+	}
+
+	if request.Attribution != "" {
+		drawAttribution(output, request.Attribution)
+	}
+	return output, nil
+}
+
+// stitchTiles renders the tiles of the area (in pixels of the zoom level) concurrently into one image, the area
+// wraps around the antimeridian and is transparent beyond the poles
+func stitchTiles(ctx context.Context, provider colors.ColorProvider, geoCoverage *terrain.GeoCoverage, pipeline ElevationPipeline, source terrain.ElevationSource, buffer int, zoom uint32, area image.Rectangle) (*image.NRGBA, error) {
+	tileSize := source.TileSize()
+	tileCount := 1 << zoom
+	canvas := image.NewNRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var renderErr error
+	limit := make(chan struct{}, runtime.NumCPU())
+
+	for tileY := floorDiv(area.Min.Y, tileSize); tileY*tileSize < area.Max.Y; tileY++ {
+		if tileY < 0 || tileY >= tileCount {
+			continue
+		}
+		for tileX := floorDiv(area.Min.X, tileSize); tileX*tileSize < area.Max.X; tileX++ {
+			offset := image.Pt(tileX*tileSize-area.Min.X, tileY*tileSize-area.Min.Y)
+			x, y := uint32((tileX%tileCount+tileCount)%tileCount), uint32(tileY)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limit <- struct{}{}
+				defer func() { <-limit }()
+
+				if ctx.Err() != nil {
+					return
+				}
+				img, err := renderTileImage(ctx, provider, geoCoverage, pipeline, source, buffer, zoom, x, y)
+				if err != nil {
+					errOnce.Do(func() {
+						renderErr = err
+						cancel()
+					})
+					return
+				}
+				// Each tile is drawn into its own cell, so they are drawn concurrently without overlapping
+				cell := image.Rectangle{Min: offset, Max: offset.Add(image.Pt(tileSize, tileSize))}
+				if img.Bounds().Dx() == tileSize && img.Bounds().Dy() == tileSize {
+					draw.Draw(canvas, cell, img, img.Bounds().Min, draw.Src)
+				} else {
+					staticMapScaler(provider).Scale(canvas, cell, img, img.Bounds(), draw.Src, nil)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if renderErr != nil {
+		return nil, renderErr
+	}
+	return canvas, ctx.Err()
+}
+
+// staticMapScaler returns the interpolation of the scaling, the data providers (which have no image formats)
+// encode values in the colors, so they are scaled without mixing the pixels
+func staticMapScaler(provider colors.ColorProvider) draw.Scaler {
+	if _, ok := provider.(colors.MultiFormatProvider); !ok {
+		return draw.NearestNeighbor
+	}
+	return draw.CatmullRom
+}
+
+// drawAttribution draws the text on a translucent box in the bottom right corner
+func drawAttribution(img draw.Image, text string) {
+	// The font has only ASCII glyphs
+	text = strings.ReplaceAll(text, "©", "(c)")
+	face := basicfont.Face7x13
+	bounds := img.Bounds()
+	textWidth := font.MeasureString(face, text).Ceil()
+	metrics := face.Metrics()
+
+	box := image.Rect(
+		bounds.Max.X-textWidth-2*staticMapAttributionPadding, bounds.Max.Y-metrics.Height.Ceil()-2*staticMapAttributionPadding,
+		bounds.Max.X, bounds.Max.Y,
+	)
+	draw.Draw(img, box, image.NewUniform(color.NRGBA{255, 255, 255, 180}), image.Point{}, draw.Over)
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.NRGBA{51, 51, 51, 255}),
+		Face: face,
+		Dot:  fixed.P(box.Min.X+staticMapAttributionPadding, box.Max.Y-staticMapAttributionPadding-metrics.Descent.Ceil()),
+	}
+	drawer.DrawString(text)
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
@@ -7,20 +7,18 @@ import (
 const fixedElevation = -220
 const minHeight = -24
 
-func fixElevationMap(elevationMap *terrain.ElevationMap, tileBounds *TileBounds, geoCoverage *terrain.GeoCoverage) {
-	if tileBounds.Zoom > 10 {
-		return
-	}
-
+func fixElevationMap(elevationMap *terrain.ElevationMap, tileBounds *terrain.TileBounds, geoCoverage *terrain.GeoCoverage) {
 	hasFixFactors := geoCoverage.HasBoundsAnyFixFactors(tileBounds.Bound())
 	if !hasFixFactors {
 		return
 	}
 
-	for y, row := range elevationMap.Data {
+	// Fix the buffer as well, so the neighborhood of the edge pixels is consistent
+	for y := -elevationMap.Buffer; y < elevationMap.TileSize+elevationMap.Buffer; y++ {
 		lat := tileBounds.GetPixelLat(y)
-		for x, cell := range row {
+		for x := -elevationMap.Buffer; x < elevationMap.TileSize+elevationMap.Buffer; x++ {
 			lon := tileBounds.GetPixelLng(x)
+			cell := elevationMap.GetElevation(x, y)
 
 			// Skip if point is in land
 			if cell > 20 || geoCoverage.IsPointInLand(lon, lat) {
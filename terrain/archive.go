@@ -0,0 +1,173 @@
+package terrain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+)
+
+// tileArchive is a single file containing a whole tileset
+type tileArchive interface {
+	MinZoom() uint32
+	MaxZoom() uint32
+	// Metadata returns the metadata value for the key or an empty string
+	Metadata(key string) string
+	// ReadTile returns the tile data, or nil if the tile is not part of the archive
+	ReadTile(coord TileCoord) ([]byte, error)
+	// FirstTile returns the data of any tile, used to inspect the tileset
+	FirstTile() ([]byte, error)
+	Close() error
+}
+
+// ArchiveSource serves elevation tiles from a MBTiles or PMTiles archive with encoded
+// (e.g. Terrarium or Terrain-RGB) tiles. Archives with tiles smaller than 512 pixels are
+// composed from the 4 subtiles like XYZSource. Missing tiles are treated as sea level.
+type ArchiveSource struct {
+	name     string
+	path     string
+	archive  tileArchive
+	decoder  ElevationDecoder
+	tileSize int
+}
+
+// NewMBTilesSource opens the MBTiles archive at the given path. If no encoding is given,
+// it is taken from the "encoding" metadata of the archive (default: terrarium).
+func NewMBTilesSource(path, encoding string) (*ArchiveSource, error) {
+	archive, err := openMBTiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return newArchiveSource("mbtiles", path, archive, encoding)
+}
+
+// NewPMTilesSource opens the PMTiles archive at the given path. If no encoding is given,
+// it is taken from the "encoding" metadata of the archive (default: terrarium).
+func NewPMTilesSource(path, encoding string) (*ArchiveSource, error) {
+	archive, err := openPMTiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return newArchiveSource("pmtiles", path, archive, encoding)
+}
+
+func newArchiveSource(name, path string, archive tileArchive, encoding string) (*ArchiveSource, error) {
+	if encoding == "" {
+		encoding = archive.Metadata("encoding")
+	}
+	if encoding == "" {
+		encoding = "terrarium"
+	}
+
+	decoder, err := GetElevationDecoder(encoding)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+
+	// Inspect a tile to know the tile size of the archive
+	data, err := archive.FirstTile()
+	if err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read tile from %s: %w", path, err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to decode tile from %s: %w", path, err)
+	}
+
+	return &ArchiveSource{
+		name:     name,
+		path:     path,
+		archive:  archive,
+		decoder:  decoder,
+		tileSize: config.Width,
+	}, nil
+}
+
+func (s *ArchiveSource) Name() string {
+	return s.name
+}
+
+// MinZoom and MaxZoom are one level below the archive for composed tiles
+func (s *ArchiveSource) MinZoom() uint32 {
+	if s.composed() {
+		return max(s.archive.MinZoom(), 1) - 1
+	}
+	return s.archive.MinZoom()
+}
+
+func (s *ArchiveSource) MaxZoom() uint32 {
+	if s.composed() {
+		return max(s.archive.MaxZoom(), 1) - 1
+	}
+	return s.archive.MaxZoom()
+}
+
+func (s *ArchiveSource) MaxTileZoom() uint32 {
+	return s.MaxZoom()
+}
+
+func (s *ArchiveSource) TileSize() int {
+	if s.composed() {
+		return 2 * s.tileSize
+	}
+	return s.tileSize
+}
+
+// composed reports whether the elevation maps are composed of the 4 subtiles of the next zoom level
+func (s *ArchiveSource) composed() bool {
+	return s.tileSize < 512
+}
+
+// Close closes the underlying archive
+func (s *ArchiveSource) Close() error {
+	return s.archive.Close()
+}
+
+func (s *ArchiveSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if coord.Z < s.MinZoom() || coord.Z > s.MaxZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+
+	return globalCache.GetOrCreate(ctx, s.path, coord, func(ctx context.Context) (*ElevationMap, error) {
+		// Large tiles are used directly, smaller ones are composed from the next zoom level
+		if !s.composed() {
+			img, err := s.readTile(coord)
+			if err != nil {
+				return nil, err
+			}
+			return newElevationMapFromImage(img, s.decoder), nil
+		}
+
+		tiles, err := fetchSubTiles(ctx, coord, func(ctx context.Context, coord TileCoord) (image.Image, error) {
+			return s.readTile(coord)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return newElevationMapFromImage(compositeImages(tiles, s.tileSize), s.decoder), nil
+	})
+}
+
+// readTile reads and decodes a single tile, a missing tile is returned as sea level
+func (s *ArchiveSource) readTile(coord TileCoord) (image.Image, error) {
+	data, err := s.archive.ReadTile(coord)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile %d/%d/%d from %s: %w", coord.Z, coord.X, coord.Y, s.path, err)
+	}
+
+	if data == nil {
+		return newSeaLevelImage(s.tileSize, s.decoder), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile %d/%d/%d from %s: %w", coord.Z, coord.X, coord.Y, s.path, err)
+	}
+
+	return img, nil
+}
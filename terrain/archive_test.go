@@ -0,0 +1,83 @@
+package terrain
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testTileElevation is the elevation of all pixels of the test tile, unique per tile of the first zoom levels
+func testTileElevation(coord TileCoord) float32 {
+	return float32(1000*coord.Z + 100*coord.X + 10*coord.Y)
+}
+
+// encodeTestTile encodes a Terrarium PNG of the size with the elevation of the tile
+func encodeTestTile(t *testing.T, coord TileCoord, size int) []byte {
+	t.Helper()
+
+	value := testTileElevation(coord) + 32768
+	pixel := color.RGBA{R: uint8(int(value) / 256), G: uint8(int(value) % 256), B: 0, A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, pixel)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testTiles returns the encoded tiles of all coordinates up to the zoom level
+func testTiles(t *testing.T, maxZoom uint32, size int) map[TileCoord][]byte {
+	tiles := make(map[TileCoord][]byte)
+	for z := uint32(0); z <= maxZoom; z++ {
+		for x := uint32(0); x < 1<<z; x++ {
+			for y := uint32(0); y < 1<<z; y++ {
+				coord := TileCoord{Z: z, X: x, Y: y}
+				tiles[coord] = encodeTestTile(t, coord, size)
+			}
+		}
+	}
+	return tiles
+}
+
+// checkArchiveSource checks the elevation maps of an archive with the test tiles of 4 pixels up to zoom 2, which
+// are composed of the 4 subtiles of the next zoom level
+func checkArchiveSource(t *testing.T, source *ArchiveSource) {
+	t.Helper()
+
+	if source.MinZoom() != 0 || source.MaxZoom() != 1 || source.MaxTileZoom() != 1 || source.TileSize() != 8 {
+		t.Fatalf("got zoom levels %d-%d (up to %d) of size %d, want 0-1 of size 8",
+			source.MinZoom(), source.MaxZoom(), source.MaxTileZoom(), source.TileSize())
+	}
+
+	coord := TileCoord{Z: 1, X: 1, Y: 0}
+	em, err := source.GetElevationMap(t.Context(), coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if em.TileSize != source.TileSize() {
+		t.Fatalf("got map of size %d, want %d", em.TileSize, source.TileSize())
+	}
+
+	// Each quadrant has the elevation of the subtile
+	for y := 0; y < em.TileSize; y++ {
+		for x := 0; x < em.TileSize; x++ {
+			subtile := TileCoord{Z: 2, X: coord.X*2 + uint32(x/4), Y: coord.Y*2 + uint32(y/4)}
+			if got, want := em.GetElevation(x, y), testTileElevation(subtile); got != want {
+				t.Fatalf("pixel %d/%d: got %v, want %v of tile %v", x, y, got, want, subtile)
+			}
+		}
+	}
+
+	if _, err := source.GetElevationMap(t.Context(), TileCoord{Z: 2}); err == nil {
+		t.Errorf("got no error beyond the max zoom")
+	}
+}
@@ -0,0 +1,101 @@
+package terrain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// GetBufferedElevationMap returns a copy of the tile's elevation map with a buffer of pixels on
+// each side, taken from the neighboring tiles of the source (using the same cache). This makes
+// neighborhood operations (smoothing, hillshade, slopes) continuous across the tile edges.
+// Beyond the poles, or if a neighbor fails, the edge pixels of the tile are repeated instead.
+func GetBufferedElevationMap(ctx context.Context, source ElevationSource, coord TileCoord, buffer int) (*ElevationMap, error) {
+	center, err := source.GetElevationMap(ctx, coord)
+	if err != nil {
+		return nil, err
+	}
+	if center.Buffer != 0 {
+		return nil, fmt.Errorf("source %s returned an already buffered map", source.Name())
+	}
+
+	buffer = max(0, min(buffer, center.TileSize))
+	tileCount := int64(1) << coord.Z
+
+	// Fetch the neighbors concurrently, indexed by [dy+1][dx+1]
+	var neighbors [3][3]*ElevationMap
+	neighbors[1][1] = center
+
+	if buffer > 0 {
+		var wg sync.WaitGroup
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				y := int64(coord.Y) + int64(dy)
+				if (dx == 0 && dy == 0) || y < 0 || y >= tileCount {
+					continue
+				}
+				// Wrap around the antimeridian
+				x := (int64(coord.X) + int64(dx) + tileCount) % tileCount
+
+				wg.Add(1)
+				go func(dx, dy int, neighbor TileCoord) {
+					defer wg.Done()
+					em, err := source.GetElevationMap(ctx, neighbor)
+					if err != nil {
+						if ctx.Err() == nil {
+							log.Printf("WARNING: failed to get neighbor tile %d/%d/%d for buffer: %v", neighbor.Z, neighbor.X, neighbor.Y, err)
+						}
+						return
+					}
+					if em.TileSize == center.TileSize && em.Buffer == 0 {
+						neighbors[dy+1][dx+1] = em
+					}
+				}(dx, dy, TileCoord{Z: coord.Z, X: uint32(x), Y: uint32(y)})
+			}
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	size := center.TileSize + 2*buffer
+	data := make([][]float32, size)
+	for row := range data {
+		data[row] = make([]float32, size)
+		y := row - buffer
+
+		for col := range data[row] {
+			x := col - buffer
+
+			// Select the tile containing the pixel, falling back to the nearest pixel of the center tile
+			tileX, tileY := tileOffset(x, center.TileSize), tileOffset(y, center.TileSize)
+			neighbor := neighbors[tileY+1][tileX+1]
+			if neighbor == nil {
+				data[row][col] = center.Data[min(max(y, 0), center.TileSize-1)][min(max(x, 0), center.TileSize-1)]
+				continue
+			}
+
+			data[row][col] = neighbor.Data[y-tileY*center.TileSize][x-tileX*center.TileSize]
+		}
+	}
+
+	return &ElevationMap{
+		Data:     data,
+		TileSize: center.TileSize,
+		Buffer:   buffer,
+	}, nil
+}
+
+// tileOffset returns -1, 0 or 1 for a pixel coordinate before, within or after the tile
+func tileOffset(pixel, tileSize int) int {
+	if pixel < 0 {
+		return -1
+	}
+	if pixel >= tileSize {
+		return 1
+	}
+	return 0
+}
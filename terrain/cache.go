@@ -1,6 +1,8 @@
 package terrain
 
 import (
+	"container/list"
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -8,47 +10,60 @@ import (
 
 // cacheEntry represents a cached elevation map with its expiration time
 type cacheEntry struct {
+	key       string
 	data      *ElevationMap
+	size      int64
 	expiresAt time.Time
 }
 
-// elevationCache is a thread-safe cache for elevation maps
+// elevationCache is a thread-safe LRU cache for elevation maps, bounded by the memory used
+// by the maps and (optionally) the number of entries. Entries can additionally expire.
 type elevationCache struct {
-	mapMu      sync.RWMutex // Mutex for protecting the entries map
-	entries    map[string]cacheEntry
-	keyMu      sync.RWMutex                  // Mutex for protecting the keyMutexes map
-	keyMutexes map[string]*sync.RWMutex      // Per-key mutexes
-	inFlightMu sync.RWMutex                  // Mutex for protecting the inFlight map
-	inFlight   map[string]chan *ElevationMap // In-flight requests
-	done       chan struct{}                 // Channel to signal cleanup goroutine to stop
+	mu         sync.Mutex
+	lru        *list.List // Front is the most recently used entry
+	entries    map[string]*list.Element
+	size       int64
+	maxBytes   int64         // Maximum memory of the cached maps, 0 for unlimited
+	maxEntries int           // Maximum number of cached maps, 0 for unlimited
+	ttl        time.Duration // Time to live of entries, 0 to keep them until evicted
+
+	inFlightMu sync.Mutex
+	inFlight   map[string]*inFlightCall // In-flight requests
+	failures   map[string]failedCall    // Recently failed requests
+	done       chan struct{}            // Channel to signal cleanup goroutine to stop
+}
+
+// inFlightCall is a running creation of a cache entry, shared by all requests for the key
+type inFlightCall struct {
+	done    chan struct{} // Closed when result and err are set
+	result  *ElevationMap
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// failedCall is a negative cache entry, so failing upstreams aren't hammered by retries
+type failedCall struct {
+	err       error
+	expiresAt time.Time
 }
 
 // newElevationCache creates a new elevation cache and starts the cleanup routine
-func newElevationCache() *elevationCache {
+func newElevationCache(maxBytes int64, maxEntries int, ttl time.Duration) *elevationCache {
 	cache := &elevationCache{
-		entries:    make(map[string]cacheEntry),
-		keyMutexes: make(map[string]*sync.RWMutex),
-		inFlight:   make(map[string]chan *ElevationMap),
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		inFlight:   make(map[string]*inFlightCall),
+		failures:   make(map[string]failedCall),
 		done:       make(chan struct{}),
 	}
 	go cache.startCleanupRoutine()
 	return cache
 }
 
-// getKeyMutex returns the mutex for a given key, creating it if it doesn't exist
-func (c *elevationCache) getKeyMutex(key string) *sync.RWMutex {
-	c.keyMu.Lock()
-	defer c.keyMu.Unlock()
-
-	if mu, exists := c.keyMutexes[key]; exists {
-		return mu
-	}
-
-	mu := &sync.RWMutex{}
-	c.keyMutexes[key] = mu
-	return mu
-}
-
 // startCleanupRoutine starts a goroutine that periodically cleans up expired entries
 func (c *elevationCache) startCleanupRoutine() {
 	ticker := time.NewTicker(time.Minute)
@@ -68,30 +83,27 @@ func (c *elevationCache) startCleanupRoutine() {
 func (c *elevationCache) cleanup() {
 	now := time.Now()
 
-	// First, get all keys that need to be checked
-	c.mapMu.RLock()
-	keys := make([]string, 0, len(c.entries))
-	for key := range c.entries {
-		keys = append(keys, key)
-	}
-	c.mapMu.RUnlock()
-
-	// Check each key individually
-	for _, key := range keys {
-		keyMutex := c.getKeyMutex(key)
-		keyMutex.Lock()
-
-		c.mapMu.Lock()
-		if entry, exists := c.entries[key]; exists && now.After(entry.expiresAt) {
-			delete(c.entries, key)
-			// Clean up the key mutex as well
-			c.keyMu.Lock()
-			delete(c.keyMutexes, key)
-			c.keyMu.Unlock()
+	c.inFlightMu.Lock()
+	for key, failure := range c.failures {
+		if now.After(failure.expiresAt) {
+			delete(c.failures, key)
 		}
-		c.mapMu.Unlock()
+	}
+	c.inFlightMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		keyMutex.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+
+	for element := c.lru.Back(); element != nil; {
+		prev := element.Prev()
+		if now.After(element.Value.(*cacheEntry).expiresAt) {
+			c.remove(element)
+		}
+		element = prev
 	}
 }
 
@@ -100,102 +112,174 @@ func (c *elevationCache) Stop() {
 	close(c.done)
 }
 
-// getCacheKey generates a unique key for a tile coordinate
-func getCacheKey(coord TileCoord) string {
-	return fmt.Sprintf("%d/%d/%d", coord.Z, coord.X, coord.Y)
+// Configure changes the limits of the cache, evicting entries above the new limits
+func (c *elevationCache) Configure(maxBytes int64, maxEntries int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxBytes = maxBytes
+	c.maxEntries = maxEntries
+	c.ttl = ttl
+	c.evict()
+}
+
+// evict removes the least recently used entries until the cache is within its limits.
+// Must be called with the mutex held.
+func (c *elevationCache) evict() {
+	for c.lru.Len() > 0 && ((c.maxBytes > 0 && c.size > c.maxBytes) || (c.maxEntries > 0 && c.lru.Len() > c.maxEntries)) {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes an entry from the cache. Must be called with the mutex held.
+func (c *elevationCache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// getCacheKey generates a unique key for a tile coordinate of a source
+func getCacheKey(source string, coord TileCoord) string {
+	return fmt.Sprintf("%s/%d/%d/%d", source, coord.Z, coord.X, coord.Y)
 }
 
-var (
-	// Global cache instance
-	globalCache = newElevationCache()
-	// Cache expiration duration - increased to 5 minutes since cleanup is now active
-	cacheExpiration = 5 * time.Minute
+// Default limits of the global cache, about 512 maps of 512x512 pixels
+const (
+	defaultCacheMaxBytes = 512 << 20
+	defaultCacheTTL      = 5 * time.Minute
+	// failureExpiration is how long a failed request is returned from the cache
+	failureExpiration = 10 * time.Second
 )
 
-// Get retrieves an elevation map from the cache if it exists and hasn't expired
-func (c *elevationCache) Get(coord TileCoord) (*ElevationMap, bool) {
-	key := getCacheKey(coord)
-	keyMutex := c.getKeyMutex(key)
+// Global cache instance
+var globalCache = newElevationCache(defaultCacheMaxBytes, 0, defaultCacheTTL)
 
-	// Use read lock for the specific key
-	keyMutex.RLock()
-	defer keyMutex.RUnlock()
+// ConfigureElevationCache sets the limits of the in-memory elevation cache. A limit of 0 is unlimited,
+// with a ttl of 0 the entries are only evicted when the cache is full.
+func ConfigureElevationCache(maxBytes int64, maxEntries int, ttl time.Duration) {
+	globalCache.Configure(maxBytes, maxEntries, ttl)
+}
 
-	// Use read lock for the map access
-	c.mapMu.RLock()
-	entry, exists := c.entries[key]
-	c.mapMu.RUnlock()
+// Get retrieves an elevation map from the cache if it exists and hasn't expired
+func (c *elevationCache) Get(source string, coord TileCoord) (*ElevationMap, bool) {
+	key := getCacheKey(source, coord)
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
 	if !exists {
 		return nil, false
 	}
 
 	// Check if the entry has expired
-	if time.Now().After(entry.expiresAt) {
+	entry := element.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.remove(element)
 		return nil, false
 	}
 
+	c.lru.MoveToFront(element)
 	return entry.data, true
 }
 
-// Set stores an elevation map in the cache with an expiration time
-func (c *elevationCache) Set(coord TileCoord, data *ElevationMap) {
-	key := getCacheKey(coord)
-	keyMutex := c.getKeyMutex(key)
+// Set stores an elevation map in the cache, evicting the least recently used maps if it is full
+func (c *elevationCache) Set(source string, coord TileCoord, data *ElevationMap) {
+	key := getCacheKey(source, coord)
+	entry := &cacheEntry{
+		key:  key,
+		data: data,
+		size: data.sizeInBytes(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Use write lock for the specific key
-	keyMutex.Lock()
-	defer keyMutex.Unlock()
+	// The ttl can be changed by Configure
+	entry.expiresAt = time.Now().Add(c.ttl)
 
-	// Use write lock for the map access
-	c.mapMu.Lock()
-	c.entries[key] = cacheEntry{
-		data:      data,
-		expiresAt: time.Now().Add(cacheExpiration),
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
 	}
-	c.mapMu.Unlock()
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += entry.size
+	c.evict()
 }
 
-// GetOrCreate gets a value from cache or creates it using the provided function
-func (c *elevationCache) GetOrCreate(coord TileCoord, create func() (*ElevationMap, error)) (*ElevationMap, error) {
-	key := getCacheKey(coord)
+// GetOrCreate gets a value from cache or creates it using the provided function. Concurrent requests
+// for the same key share a single call of create, which runs under a context detached from the
+// requests: it is only cancelled when all waiting requests are gone. Failures are cached briefly.
+func (c *elevationCache) GetOrCreate(ctx context.Context, source string, coord TileCoord, create func(ctx context.Context) (*ElevationMap, error)) (*ElevationMap, error) {
+	key := getCacheKey(source, coord)
 
 	// First try to get from cache
-	if em, found := c.Get(coord); found {
+	if em, found := c.Get(source, coord); found {
 		return em, nil
 	}
 
-	// Check for in-flight request
 	c.inFlightMu.Lock()
-	if ch, exists := c.inFlight[key]; exists {
-		c.inFlightMu.Unlock()
-		// Wait for the in-flight request to complete
-		return <-ch, nil
+	if failure, exists := c.failures[key]; exists {
+		if time.Now().Before(failure.expiresAt) {
+			c.inFlightMu.Unlock()
+			return nil, failure.err
+		}
+		delete(c.failures, key)
 	}
 
-	// Create channel for this request
-	ch := make(chan *ElevationMap, 1)
-	c.inFlight[key] = ch
+	// Join the in-flight request or start a new one
+	call, exists := c.inFlight[key]
+	if exists {
+		call.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inFlightCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.inFlight[key] = call
+		go c.run(callCtx, key, source, coord, call, create)
+	}
 	c.inFlightMu.Unlock()
 
-	// Create the value
-	em, err := create()
-	if err != nil {
-		// On error, remove from in-flight and return error
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
 		c.inFlightMu.Lock()
-		delete(c.inFlight, key)
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody is interested anymore, later requests start a new call
+			call.cancel()
+			if c.inFlight[key] == call {
+				delete(c.inFlight, key)
+			}
+		}
 		c.inFlightMu.Unlock()
-		return nil, err
+		return nil, ctx.Err()
 	}
+}
 
-	// Store in cache
-	c.Set(coord, em)
+// run creates the value of an in-flight call and publishes the result to all waiters
+func (c *elevationCache) run(ctx context.Context, key, source string, coord TileCoord, call *inFlightCall, create func(ctx context.Context) (*ElevationMap, error)) {
+	defer call.cancel()
+
+	em, err := create(ctx)
+	if err == nil && em == nil {
+		err = fmt.Errorf("no elevation map created for %s", key)
+	}
+	if err == nil {
+		c.Set(source, coord, em)
+	}
 
-	// Notify any waiting goroutines and cleanup
-	ch <- em
 	c.inFlightMu.Lock()
-	delete(c.inFlight, key)
+	call.result, call.err = em, err
+	if c.inFlight[key] == call {
+		delete(c.inFlight, key)
+	}
+	// Cancellations are no failures of the source
+	if err != nil && ctx.Err() == nil {
+		c.failures[key] = failedCall{err: err, expiresAt: time.Now().Add(failureExpiration)}
+	}
 	c.inFlightMu.Unlock()
 
-	return em, nil
+	close(call.done)
 }
@@ -0,0 +1,36 @@
+package terrain
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElevationCacheConfigureConcurrently(t *testing.T) {
+	cache := newElevationCache(0, 0, time.Minute)
+	defer cache.Stop()
+
+	// Run with -race: the limits are changed while maps are stored
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Set("test", TileCoord{Z: 10, X: uint32(i), Y: uint32(j)}, newEmptyElevationMap(4))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Configure(0, 50, time.Duration(j+1)*time.Second)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cache.Configure(0, 50, time.Minute)
+	if count := cache.lru.Len(); count != 50 {
+		t.Errorf("got %d cached maps, want the limit of 50", count)
+	}
+}
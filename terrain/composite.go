@@ -0,0 +1,384 @@
+package terrain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/mxzinke/colorful-terrarium/polygon"
+	"github.com/paulmach/orb"
+)
+
+// compositeFeatherStep is the pixel spacing at which feathered coverage weights are calculated
+// (and interpolated in between), as the distance to the coverage edges is expensive
+const compositeFeatherStep = 8
+
+// compositeConfig is the JSON configuration of a composite source
+type compositeConfig struct {
+	Layers []compositeLayerConfig `json:"layers"`
+}
+
+// compositeLayerConfig configures a single layer, the first layer has the highest priority
+type compositeLayerConfig struct {
+	// Source is the elevation source spec (see NewElevationSource)
+	Source string `json:"source"`
+	// Coverage is an optional GeoJSON file with the polygons in which the layer is used
+	Coverage string `json:"coverage,omitempty"`
+	// Feather is the distance in degrees inside the coverage (and from nodata pixels) over which the layer is
+	// faded in
+	Feather float64 `json:"feather,omitempty"`
+	// Nodata is the elevation value of pixels without data, which are filled by the next layers
+	Nodata *float32 `json:"nodata,omitempty"`
+	// MinZoom and MaxZoom limit the zoom levels at which the layer is used
+	MinZoom *uint32 `json:"minZoom,omitempty"`
+	MaxZoom *uint32 `json:"maxZoom,omitempty"`
+}
+
+type compositeLayer struct {
+	source   ElevationSource
+	coverage polygon.SpatialIndexer
+	feather  float64
+	nodata   *float32
+	minZoom  uint32
+	maxZoom  uint32
+}
+
+// newCompositeLayer creates the layer of the source (without its coverage), the configured zoom levels are limited
+// to the zoom levels the source serves
+func newCompositeLayer(source ElevationSource, config compositeLayerConfig) *compositeLayer {
+	layer := &compositeLayer{
+		source:  source,
+		feather: config.Feather,
+		nodata:  config.Nodata,
+		minZoom: source.MinZoom(),
+		maxZoom: source.MaxTileZoom(),
+	}
+	if config.MinZoom != nil {
+		layer.minZoom = max(*config.MinZoom, layer.minZoom)
+	}
+	if config.MaxZoom != nil {
+		layer.maxZoom = min(*config.MaxZoom, layer.maxZoom)
+	}
+	return layer
+}
+
+// usedFor returns whether the layer contributes to the tile
+func (l *compositeLayer) usedFor(coord TileCoord, bound orb.Bound) bool {
+	if coord.Z < l.minZoom || coord.Z > l.maxZoom {
+		return false
+	}
+	return l.coverage == nil || l.coverage.BoundsInAnyPolygon(bound)
+}
+
+// featherPixels returns the feather distance in pixels of the layer maps at the zoom level, limited to a tile
+func (l *compositeLayer) featherPixels(z uint32) float64 {
+	degreesPerPixel := 360 / (math.Exp2(float64(z)) * float64(l.source.TileSize()))
+	return math.Min(l.feather/degreesPerPixel, float64(l.source.TileSize()))
+}
+
+// elevationMap returns the map of the layer, buffered by the feather distance if its nodata edges are feathered
+func (l *compositeLayer) elevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if l.nodata == nil || l.featherPixels(coord.Z) < 1 {
+		return l.source.GetElevationMap(ctx, coord)
+	}
+	return GetBufferedElevationMap(ctx, l.source, coord, int(math.Ceil(l.featherPixels(coord.Z))))
+}
+
+// hasData returns whether the elevation of the layer is valid
+func (l *compositeLayer) hasData(elevation float32) bool {
+	return !math.IsNaN(float64(elevation)) && (l.nodata == nil || elevation != *l.nodata)
+}
+
+// coverageWeight returns how much the layer contributes at the point (0 outside, 1 fully inside the coverage)
+func (l *compositeLayer) coverageWeight(point orb.Point) float64 {
+	if l.coverage == nil {
+		return 1
+	}
+
+	if l.feather <= 0 {
+		if l.coverage.PointInAnyPolygon(point) {
+			return 1
+		}
+		return 0
+	}
+
+	weight := 0.0
+	for _, poly := range l.coverage.PointInPolygons(point) {
+		distance := polygon.DistanceToPolygon(point, *poly)
+		weight = math.Max(weight, math.Min(distance/l.feather, 1))
+	}
+	return weight
+}
+
+// CompositeSource merges multiple elevation sources per pixel. The layers are ordered by priority,
+// a layer is only used within its coverage polygons and where it has data, the remaining area is
+// filled by the following layers. Feathered layers are blended with the layers below at the edges of
+// their coverage and of their nodata areas.
+type CompositeSource struct {
+	path     string
+	layers   []*compositeLayer
+	tileSize int
+}
+
+// NewCompositeSource creates a composite source from a JSON layer configuration file
+func NewCompositeSource(path string) (*CompositeSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config compositeConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse composite config %s: %w", path, err)
+	}
+
+	if len(config.Layers) == 0 {
+		return nil, fmt.Errorf("composite config %s has no layers", path)
+	}
+
+	source := &CompositeSource{path: path}
+	for i, layerConfig := range config.Layers {
+		layerSource, err := NewElevationSource(layerConfig.Source)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", i, err)
+		}
+
+		layer := newCompositeLayer(layerSource, layerConfig)
+		if layerConfig.Coverage != "" {
+			layer.coverage, err = loadIndexerFromGeojson(layerConfig.Coverage)
+			if err != nil {
+				return nil, fmt.Errorf("layer %d: failed to load coverage: %w", i, err)
+			}
+		}
+
+		source.layers = append(source.layers, layer)
+		source.tileSize = max(source.tileSize, layerSource.TileSize())
+	}
+
+	return source, nil
+}
+
+func (s *CompositeSource) Name() string {
+	return "composite"
+}
+
+func (s *CompositeSource) MinZoom() uint32 {
+	minZoom := s.layers[0].minZoom
+	for _, layer := range s.layers[1:] {
+		minZoom = min(minZoom, layer.minZoom)
+	}
+	return minZoom
+}
+
+func (s *CompositeSource) MaxZoom() uint32 {
+	maxZoom := uint32(0)
+	for _, layer := range s.layers {
+		maxZoom = max(maxZoom, min(layer.maxZoom, layer.source.MaxZoom()))
+	}
+	return maxZoom
+}
+
+func (s *CompositeSource) MaxTileZoom() uint32 {
+	maxZoom := uint32(0)
+	for _, layer := range s.layers {
+		maxZoom = max(maxZoom, layer.maxZoom)
+	}
+	return maxZoom
+}
+
+func (s *CompositeSource) TileSize() int {
+	return s.tileSize
+}
+
+// GetElevationMap fetches the layers covering the tile concurrently and merges them. The merged maps are cached
+// besides the maps of the layer sources, both count towards the memory limit of the cache. As the layer maps are
+// only read again to merge missing tiles, they are evicted first.
+func (s *CompositeSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	// Tiles without layers fail before the cache, so the error isn't cached as failed request
+	bound := CreateTileBounds(coord.Z, coord.Y, coord.X, 2).Bound()
+	layers := make([]*compositeLayer, 0, len(s.layers))
+	for _, layer := range s.layers {
+		if layer.usedFor(coord, bound) {
+			layers = append(layers, layer)
+		}
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no layer of source %s covers tile %d/%d/%d", s.Name(), coord.Z, coord.X, coord.Y)
+	}
+
+	return globalCache.GetOrCreate(ctx, s.path, coord, func(ctx context.Context) (*ElevationMap, error) {
+		maps := make([]*ElevationMap, len(layers))
+		errs := make([]error, len(layers))
+
+		var wg sync.WaitGroup
+		for i, layer := range layers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				maps[i], errs[i] = layer.elevationMap(ctx, coord)
+			}()
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("failed to get layer %s: %w", layers[i].source.Name(), err)
+			}
+		}
+
+		// Always at the size of the largest layer maps, the smaller maps are scaled up
+		return mergeElevationMaps(ctx, CreateTileBounds(coord.Z, coord.Y, coord.X, s.tileSize), coord.Z, layers, maps)
+	})
+}
+
+// mergeElevationMaps blends the layer maps in priority order, pixels without any data are sea level
+func mergeElevationMaps(ctx context.Context, tile *TileBounds, z uint32, layers []*compositeLayer, maps []*ElevationMap) (*ElevationMap, error) {
+	tileSize := len(tile.yLookup)
+	weights := make([]func(x, y int) float64, len(layers))
+	for i, layer := range layers {
+		weights[i] = coverageWeights(tile, tileSize, layer)
+		if maps[i].Buffer > 0 {
+			weights[i] = nodataWeights(maps[i], tileSize, layer, layer.featherPixels(z), weights[i])
+		}
+	}
+
+	result := newEmptyElevationMap(tileSize)
+	for y := 0; y < tileSize; y++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		for x := 0; x < tileSize; x++ {
+			value, remaining := 0.0, 1.0
+			for i, layer := range layers {
+				elevation := sampleElevationMap(maps[i], x, y, tileSize)
+				if !layer.hasData(elevation) {
+					continue
+				}
+
+				weight := weights[i](x, y)
+				if weight <= 0 {
+					continue
+				}
+
+				value += remaining * weight * float64(elevation)
+				remaining *= 1 - weight
+				if remaining <= 0 {
+					break
+				}
+			}
+
+			// Normalize, so a feathered layer above nodata areas isn't faded to sea level
+			if remaining < 1 {
+				result.Data[y][x] = float32(value / (1 - remaining))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// sampleElevationMap returns the nearest pixel of the map for a pixel of a tile with the given size
+func sampleElevationMap(em *ElevationMap, x, y, tileSize int) float32 {
+	if em.TileSize == tileSize {
+		return em.Data[y+em.Buffer][x+em.Buffer]
+	}
+	return em.Data[y*em.TileSize/tileSize+em.Buffer][x*em.TileSize/tileSize+em.Buffer]
+}
+
+// nodataWeights limits the coverage weights of a layer by the distance to its nodata pixels, which are found in
+// the buffer of the map as well, so the weights continue across the tile edges
+func nodataWeights(em *ElevationMap, tileSize int, layer *compositeLayer, feather float64, coverage func(x, y int) float64) func(x, y int) float64 {
+	distances := nodataDistances(em, layer)
+	if distances == nil {
+		return coverage
+	}
+
+	size := len(em.Data)
+	return func(x, y int) float64 {
+		px, py := x*em.TileSize/tileSize+em.Buffer, y*em.TileSize/tileSize+em.Buffer
+		return math.Min(coverage(x, y), math.Min(distances[py*size+px]/feather, 1))
+	}
+}
+
+// nodataDistances returns the distance in pixels of each pixel of the map (including the buffer) to the nearest
+// nodata pixel, approximated by a two pass chamfer distance transform. Maps without nodata pixels return nil.
+func nodataDistances(em *ElevationMap, layer *compositeLayer) []float64 {
+	size := len(em.Data)
+	distances := make([]float64, size*size)
+	found := false
+	for y, row := range em.Data {
+		for x, elevation := range row {
+			if layer.hasData(elevation) {
+				distances[y*size+x] = math.Inf(1)
+			} else {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	relax := func(x, y, dx, dy int, cost float64) {
+		nx, ny := x+dx, y+dy
+		if nx >= 0 && nx < size && ny >= 0 && ny < size {
+			distances[y*size+x] = math.Min(distances[y*size+x], distances[ny*size+nx]+cost)
+		}
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			relax(x, y, -1, 0, 1)
+			relax(x, y, 0, -1, 1)
+			relax(x, y, -1, -1, math.Sqrt2)
+			relax(x, y, 1, -1, math.Sqrt2)
+		}
+	}
+	for y := size - 1; y >= 0; y-- {
+		for x := size - 1; x >= 0; x-- {
+			relax(x, y, 1, 0, 1)
+			relax(x, y, 0, 1, 1)
+			relax(x, y, 1, 1, math.Sqrt2)
+			relax(x, y, -1, 1, math.Sqrt2)
+		}
+	}
+	return distances
+}
+
+// coverageWeights returns the coverage weight lookup of a layer for the pixels of the tile
+func coverageWeights(tile *TileBounds, tileSize int, layer *compositeLayer) func(x, y int) float64 {
+	if layer.coverage == nil {
+		return func(x, y int) float64 { return 1 }
+	}
+
+	if layer.feather <= 0 {
+		return func(x, y int) float64 {
+			return layer.coverageWeight(orb.Point{tile.GetPixelLng(x), tile.GetPixelLat(y)})
+		}
+	}
+
+	// Calculate the weights on a coarse grid and interpolate bilinear in between
+	gridSize := (tileSize-1)/compositeFeatherStep + 2
+	grid := make([][]float64, gridSize)
+	for gy := range grid {
+		grid[gy] = make([]float64, gridSize)
+		for gx := range grid[gy] {
+			px := min(gx*compositeFeatherStep, tileSize-1)
+			py := min(gy*compositeFeatherStep, tileSize-1)
+			grid[gy][gx] = layer.coverageWeight(orb.Point{tile.GetPixelLng(px), tile.GetPixelLat(py)})
+		}
+	}
+
+	return func(x, y int) float64 {
+		gx, gy := x/compositeFeatherStep, y/compositeFeatherStep
+		fx := float64(x%compositeFeatherStep) / compositeFeatherStep
+		fy := float64(y%compositeFeatherStep) / compositeFeatherStep
+
+		top := grid[gy][gx]*(1-fx) + grid[gy][gx+1]*fx
+		bottom := grid[gy+1][gx]*(1-fx) + grid[gy+1][gx+1]*fx
+		return top*(1-fy) + bottom*fy
+	}
+}
@@ -0,0 +1,168 @@
+package terrain
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+// flatSource serves maps of a constant elevation within its zoom levels
+type flatSource struct {
+	elevation        float32
+	minZoom, maxZoom uint32
+	maxTileZoom      uint32
+	tileSize         int
+}
+
+func (s *flatSource) Name() string        { return "flat" }
+func (s *flatSource) MinZoom() uint32     { return s.minZoom }
+func (s *flatSource) MaxZoom() uint32     { return s.maxZoom }
+func (s *flatSource) MaxTileZoom() uint32 { return s.maxTileZoom }
+func (s *flatSource) TileSize() int       { return s.tileSize }
+
+func (s *flatSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if coord.Z < s.minZoom || coord.Z > s.maxTileZoom {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+	em := newEmptyElevationMap(s.tileSize)
+	for _, row := range em.Data {
+		for x := range row {
+			row[x] = s.elevation
+		}
+	}
+	return em, nil
+}
+
+func TestCompositeLayerZoomLevels(t *testing.T) {
+	source := &flatSource{minZoom: 2, maxZoom: 8, maxTileZoom: 10, tileSize: 512}
+	zoom := func(z uint32) *uint32 { return &z }
+
+	tests := []struct {
+		name             string
+		config           compositeLayerConfig
+		minZoom, maxZoom uint32
+	}{
+		{"source zoom levels", compositeLayerConfig{}, 2, 10},
+		{"narrower config", compositeLayerConfig{MinZoom: zoom(4), MaxZoom: zoom(6)}, 4, 6},
+		{"wider config", compositeLayerConfig{MinZoom: zoom(0), MaxZoom: zoom(20)}, 2, 10},
+	}
+
+	for _, test := range tests {
+		layer := newCompositeLayer(source, test.config)
+		for z := uint32(0); z <= 12; z++ {
+			want := z >= test.minZoom && z <= test.maxZoom
+			if used := layer.usedFor(TileCoord{Z: z}, orb.Bound{}); used != want {
+				t.Errorf("%s: layer used at zoom %d is %v, want %v", test.name, z, used, want)
+			}
+		}
+	}
+}
+
+func TestCompositeSourceMaxZoom(t *testing.T) {
+	low := &flatSource{elevation: 1, maxZoom: 8, maxTileZoom: 8, tileSize: 512}
+	high := &flatSource{elevation: 2, maxZoom: 12, maxTileZoom: 16, tileSize: 256}
+	maxZoom := uint32(10)
+
+	source := &CompositeSource{
+		path: "test",
+		layers: []*compositeLayer{
+			newCompositeLayer(high, compositeLayerConfig{MaxZoom: &maxZoom}),
+			newCompositeLayer(low, compositeLayerConfig{}),
+		},
+		tileSize: 512,
+	}
+
+	if source.MaxZoom() != 10 || source.MaxTileZoom() != 10 {
+		t.Fatalf("got zoom levels up to %d (%d full resolution), want 10", source.MaxTileZoom(), source.MaxZoom())
+	}
+
+	// Every zoom level up to the max tile zoom is served, by the layers covering it
+	for z := uint32(0); z <= source.MaxTileZoom(); z++ {
+		em, err := source.GetElevationMap(context.Background(), TileCoord{Z: z})
+		if err != nil {
+			t.Fatalf("zoom %d: %v", z, err)
+		}
+		if em.TileSize != 512 {
+			t.Errorf("zoom %d: got tile size %d, want 512", z, em.TileSize)
+		}
+	}
+	if _, err := source.GetElevationMap(context.Background(), TileCoord{Z: source.MaxTileZoom() + 1}); err == nil {
+		t.Errorf("zoom %d: got no error beyond the max tile zoom", source.MaxTileZoom()+1)
+	}
+}
+
+// halfNodataSource serves maps with nodata in the left half of each tile and the elevation in the right half
+type halfNodataSource struct {
+	flatSource
+	nodata float32
+}
+
+func (s *halfNodataSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	em, err := s.flatSource.GetElevationMap(ctx, coord)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range em.Data {
+		for x := range row[:s.tileSize/2] {
+			row[x] = s.nodata
+		}
+	}
+	return em, nil
+}
+
+func TestCompositeSourceFeatherNodata(t *testing.T) {
+	nodata := float32(-9999)
+	regional := &halfNodataSource{flatSource: flatSource{elevation: 100, maxZoom: 4, maxTileZoom: 4, tileSize: 64}, nodata: nodata}
+	global := &flatSource{maxZoom: 4, maxTileZoom: 4, tileSize: 64}
+
+	// 16 pixels of 1.40625 degrees at zoom 2
+	source := &CompositeSource{
+		path: "test-feather",
+		layers: []*compositeLayer{
+			newCompositeLayer(regional, compositeLayerConfig{Feather: 22.5, Nodata: &nodata}),
+			newCompositeLayer(global, compositeLayerConfig{}),
+		},
+		tileSize: 64,
+	}
+
+	em, err := source.GetElevationMap(context.Background(), TileCoord{Z: 2, X: 1, Y: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The layer is faded in from its nodata half and from the nodata half of the next tile
+	for x := 0; x < 64; x++ {
+		want := float32(0)
+		if x >= 32 {
+			want = 100 * float32(min(x-31, 64-x, 16)) / 16
+		}
+		for _, y := range []int{0, 31, 63} {
+			if got := em.GetElevation(x, y); math.Abs(float64(got-want)) > 1e-3 {
+				t.Errorf("pixel %d/%d: got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestCompositeSourceUncoveredZoom(t *testing.T) {
+	source := &CompositeSource{
+		path:     "test-uncovered",
+		layers:   []*compositeLayer{newCompositeLayer(&flatSource{minZoom: 3, maxZoom: 5, maxTileZoom: 5, tileSize: 512}, compositeLayerConfig{})},
+		tileSize: 512,
+	}
+
+	coord := TileCoord{Z: 1}
+	if _, err := source.GetElevationMap(context.Background(), coord); err == nil {
+		t.Fatal("got no error for a zoom level without layers")
+	}
+
+	globalCache.inFlightMu.Lock()
+	_, cached := globalCache.failures[getCacheKey(source.path, coord)]
+	globalCache.inFlightMu.Unlock()
+	if cached {
+		t.Errorf("got a cached failure for a zoom level without layers")
+	}
+}
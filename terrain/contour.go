@@ -0,0 +1,196 @@
+package terrain
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+)
+
+// ContourLine is a line of equal elevation, in pixel coordinates of the tile (the elevation of a pixel is at
+// its center, the tile covers 0 to TileSize). Lines through the buffer extend beyond the tile.
+type ContourLine struct {
+	Elevation float64
+	Line      orb.LineString
+}
+
+// contourSegment connects two crossings of a contour level with the edges of a grid cell
+type contourSegment struct {
+	from, to int
+}
+
+// TraceContours runs marching squares over the elevation map (including its buffer) and returns the joined
+// contour lines of all levels which are multiples of the interval, ordered by elevation. Saddle cells are
+// resolved by the average of the cell, cells with NaN elevation are skipped.
+func (em *ElevationMap) TraceContours(interval float64) []ContourLine {
+	size := len(em.Data)
+	if size < 2 || interval <= 0 {
+		return nil
+	}
+	width := len(em.Data[0])
+
+	// Crossings of a level are identified by the grid edge: 2*index is the edge to the right, 2*index+1
+	// the one below
+	points := make(map[float64]map[int]orb.Point)
+	segments := make(map[float64][]contourSegment)
+
+	crossing := func(level float64, x1, y1 int, e1 float64, x2, y2 int, e2 float64) int {
+		key := 2 * (y1*width + x1)
+		if y2 != y1 {
+			key++
+		}
+		levelPoints := points[level]
+		if levelPoints == nil {
+			levelPoints = make(map[int]orb.Point)
+			points[level] = levelPoints
+		}
+		if _, ok := levelPoints[key]; !ok {
+			t := (level - e1) / (e2 - e1)
+			levelPoints[key] = orb.Point{
+				float64(x1) + t*float64(x2-x1) + 0.5 - float64(em.Buffer),
+				float64(y1) + t*float64(y2-y1) + 0.5 - float64(em.Buffer),
+			}
+		}
+		return key
+	}
+
+	for y := 0; y+1 < size; y++ {
+		for x := 0; x+1 < width; x++ {
+			topLeft, topRight := float64(em.Data[y][x]), float64(em.Data[y][x+1])
+			bottomLeft, bottomRight := float64(em.Data[y+1][x]), float64(em.Data[y+1][x+1])
+
+			low := math.Min(math.Min(topLeft, topRight), math.Min(bottomLeft, bottomRight))
+			high := math.Max(math.Max(topLeft, topRight), math.Max(bottomLeft, bottomRight))
+			if math.IsNaN(low) || math.IsNaN(high) {
+				continue
+			}
+
+			// Corners at a level count as above it, so levels in (low, high] cross the cell
+			for step := math.Floor(low/interval) + 1; step*interval <= high; step++ {
+				level := step * interval
+				index := 0
+				if topLeft >= level {
+					index |= 8
+				}
+				if topRight >= level {
+					index |= 4
+				}
+				if bottomRight >= level {
+					index |= 2
+				}
+				if bottomLeft >= level {
+					index |= 1
+				}
+
+				// Crossings with the top, right, bottom and left edge of the cell, as needed by the case
+				top := func() int { return crossing(level, x, y, topLeft, x+1, y, topRight) }
+				right := func() int { return crossing(level, x+1, y, topRight, x+1, y+1, bottomRight) }
+				bottom := func() int { return crossing(level, x, y+1, bottomLeft, x+1, y+1, bottomRight) }
+				left := func() int { return crossing(level, x, y, topLeft, x, y+1, bottomLeft) }
+
+				add := func(from, to int) {
+					segments[level] = append(segments[level], contourSegment{from: from, to: to})
+				}
+
+				switch index {
+				case 1, 14:
+					add(left(), bottom())
+				case 2, 13:
+					add(bottom(), right())
+				case 3, 12:
+					add(left(), right())
+				case 4, 11:
+					add(top(), right())
+				case 6, 9:
+					add(top(), bottom())
+				case 7, 8:
+					add(left(), top())
+				case 5, 10:
+					center := (topLeft + topRight + bottomLeft + bottomRight) / 4
+					// The diagonal of the corners with the center's side is connected
+					if (index == 5) == (center >= level) {
+						add(left(), top())
+						add(bottom(), right())
+					} else {
+						add(top(), right())
+						add(left(), bottom())
+					}
+				}
+			}
+		}
+	}
+
+	levels := make([]float64, 0, len(segments))
+	for level := range segments {
+		levels = append(levels, level)
+	}
+	sort.Float64s(levels)
+
+	var contours []ContourLine
+	for _, level := range levels {
+		for _, line := range joinContourSegments(segments[level], points[level]) {
+			contours = append(contours, ContourLine{Elevation: level, Line: line})
+		}
+	}
+	return contours
+}
+
+// joinContourSegments joins the segments sharing a crossing into lines. Each crossing is shared by at most
+// two segments (of the cells on both sides of the edge).
+func joinContourSegments(segments []contourSegment, points map[int]orb.Point) []orb.LineString {
+	byCrossing := make(map[int][]int, 2*len(segments))
+	for i, segment := range segments {
+		byCrossing[segment.from] = append(byCrossing[segment.from], i)
+		byCrossing[segment.to] = append(byCrossing[segment.to], i)
+	}
+
+	used := make([]bool, len(segments))
+
+	// follow walks from the crossing along unused segments and returns the crossings passed
+	follow := func(crossing int) []int {
+		var path []int
+		for {
+			next := -1
+			for _, i := range byCrossing[crossing] {
+				if !used[i] {
+					next = i
+					break
+				}
+			}
+			if next < 0 {
+				return path
+			}
+
+			used[next] = true
+			if segments[next].from == crossing {
+				crossing = segments[next].to
+			} else {
+				crossing = segments[next].from
+			}
+			path = append(path, crossing)
+		}
+	}
+
+	var lines []orb.LineString
+	for i, segment := range segments {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+
+		// Walk into both directions, closed lines return to the start in the forward walk
+		forward := follow(segment.to)
+		backward := follow(segment.from)
+
+		line := make(orb.LineString, 0, len(backward)+len(forward)+2)
+		for j := len(backward) - 1; j >= 0; j-- {
+			line = append(line, points[backward[j]])
+		}
+		line = append(line, points[segment.from], points[segment.to])
+		for _, crossing := range forward {
+			line = append(line, points[crossing])
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,170 @@
+package terrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const directoryTileLayout = "{z}/{x}/{y}.png"
+
+// DirectorySource reads elevation tiles from a local {z}/{x}/{y} file tree. Tiles ending with
+// .png are decoded with the configured encoding (composed from the 4 subtiles like XYZSource),
+// tiles ending with .tif are read as 16-bit GeoTIFF. Missing files are treated as sea level.
+type DirectorySource struct {
+	path    string
+	decoder ElevationDecoder
+	geotiff bool
+	minZoom uint32
+	maxZoom uint32
+}
+
+// NewDirectorySource creates a source for the given path template (with {z}/{x}/{y} placeholders).
+// If the path has no placeholders, it is used as root directory of a {z}/{x}/{y}.png tree.
+func NewDirectorySource(path string, decoder ElevationDecoder) (*DirectorySource, error) {
+	if !strings.Contains(path, "{z}") {
+		path = filepath.Join(path, directoryTileLayout)
+	}
+
+	root, _, _ := strings.Cut(path, "{z}")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile directory: %w", err)
+	}
+
+	// Detect the available zoom levels from the directory names
+	minZoom, maxZoom := uint32(0), uint32(0)
+	found := false
+	for _, entry := range entries {
+		z, err := strconv.ParseUint(entry.Name(), 10, 8)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if !found || uint32(z) < minZoom {
+			minZoom = uint32(z)
+		}
+		if !found || uint32(z) > maxZoom {
+			maxZoom = uint32(z)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no zoom level directories found in %s", root)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+
+	return &DirectorySource{
+		path:    path,
+		decoder: decoder,
+		geotiff: ext == ".tif" || ext == ".tiff",
+		minZoom: minZoom,
+		maxZoom: maxZoom,
+	}, nil
+}
+
+func (s *DirectorySource) Name() string {
+	return "dir"
+}
+
+// MinZoom and MaxZoom are one level below the tile directories for image tiles, as the maps are composed of
+// their subtiles
+func (s *DirectorySource) MinZoom() uint32 {
+	if s.geotiff {
+		return s.minZoom
+	}
+	return max(s.minZoom, 1) - 1
+}
+
+func (s *DirectorySource) MaxZoom() uint32 {
+	if s.geotiff {
+		return s.maxZoom
+	}
+	return max(s.maxZoom, 1) - 1
+}
+
+func (s *DirectorySource) MaxTileZoom() uint32 {
+	return s.MaxZoom()
+}
+
+func (s *DirectorySource) TileSize() int {
+	if s.geotiff {
+		return 512
+	}
+	return 2 * tileSize
+}
+
+func (s *DirectorySource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if s.geotiff {
+		if coord.Z < s.MinZoom() || coord.Z > s.MaxZoom() {
+			return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+		}
+
+		return globalCache.GetOrCreate(ctx, s.path, coord, func(ctx context.Context) (*ElevationMap, error) {
+			return s.readGeoTIFF(coord)
+		})
+	}
+
+	if coord.Z < s.MinZoom() || coord.Z > s.MaxZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+
+	return globalCache.GetOrCreate(ctx, s.path, coord, func(ctx context.Context) (*ElevationMap, error) {
+		tiles, err := fetchSubTiles(ctx, coord, func(ctx context.Context, coord TileCoord) (image.Image, error) {
+			return s.readImage(coord)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return newElevationMapFromImage(compositeImages(tiles, tileSize), s.decoder), nil
+	})
+}
+
+// readImage reads a single encoded tile, a missing tile is returned as sea level
+func (s *DirectorySource) readImage(coord TileCoord) (image.Image, error) {
+	file, err := os.Open(formatTileTemplate(s.path, coord))
+	if errors.Is(err, fs.ErrNotExist) {
+		return newSeaLevelImage(tileSize, s.decoder), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tile: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile %s: %w", file.Name(), err)
+	}
+
+	return img, nil
+}
+
+// readGeoTIFF reads a single GeoTIFF tile, a missing tile is returned as sea level
+func (s *DirectorySource) readGeoTIFF(coord TileCoord) (*ElevationMap, error) {
+	path := formatTileTemplate(s.path, coord)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newEmptyElevationMap(s.TileSize()), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile: %w", err)
+	}
+
+	matrix, tileSize, err := readTIFFToFloat32Matrix(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode TIFF %s: %v", path, err)
+	}
+
+	return &ElevationMap{
+		Data:     matrix,
+		TileSize: tileSize,
+	}, nil
+}
@@ -0,0 +1,256 @@
+package terrain
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCacheTempPrefix marks files which are still being written
+const diskCacheTempPrefix = ".tmp-"
+
+// diskCacheEntry is a file stored in the disk cache
+type diskCacheEntry struct {
+	key       string
+	size      int64
+	createdAt time.Time
+}
+
+// DiskCache is a persistent cache for upstream tile data. Files are evicted least recently used
+// first when the cache exceeds its maximum size, and when they are older than the maximum age.
+// Files are written atomically, so the cache stays consistent when the process is killed.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // Front is the most recently used entry
+	entries map[string]*list.Element
+}
+
+// NewDiskCache opens (or creates) a disk cache in the directory. A maxSize or maxAge of 0 disables the limit.
+func NewDiskCache(dir string, maxSize int64, maxAge time.Duration) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create disk cache directory: %w", err)
+	}
+
+	cache := &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	if err := cache.load(); err != nil {
+		return nil, fmt.Errorf("failed to load disk cache: %w", err)
+	}
+
+	cache.mu.Lock()
+	for element := cache.lru.Back(); element != nil; {
+		prev := element.Prev()
+		if cache.expired(element.Value.(*diskCacheEntry)) {
+			cache.remove(element)
+		}
+		element = prev
+	}
+	cache.evict()
+	cache.mu.Unlock()
+
+	log.Printf("Loaded disk cache %s with %d files (%d MB)", dir, len(cache.entries), cache.size>>20)
+
+	return cache, nil
+}
+
+// load indexes the existing files, the least recently written files are evicted first
+func (c *DiskCache) load() error {
+	files := make([]*diskCacheEntry, 0)
+	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		// Remove leftovers of interrupted writes
+		if strings.HasPrefix(entry.Name(), diskCacheTempPrefix) {
+			return os.Remove(path)
+		}
+		if len(entry.Name()) != sha256.Size*2 {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, &diskCacheEntry{key: entry.Name(), size: info.Size(), createdAt: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].createdAt.After(files[j].createdAt)
+	})
+
+	for _, file := range files {
+		c.entries[file.key] = c.lru.PushBack(file)
+		c.size += file.size
+	}
+
+	return nil
+}
+
+// path returns the file path of a key, which is spread over subdirectories to keep them small
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// hashKey creates a file name safe key (e.g. from an URL)
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Get returns the cached data for the key
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	data, _, found := c.GetWithTime(key)
+	return data, found
+}
+
+// GetWithTime returns the cached data for the key and the time it was stored
+func (c *DiskCache) GetWithTime(key string) ([]byte, time.Time, bool) {
+	key = hashKey(key)
+
+	c.mu.Lock()
+	element, exists := c.entries[key]
+	if !exists {
+		c.mu.Unlock()
+		return nil, time.Time{}, false
+	}
+
+	entry := element.Value.(*diskCacheEntry)
+	if c.expired(entry) {
+		c.remove(element)
+		c.mu.Unlock()
+		return nil, time.Time{}, false
+	}
+	c.lru.MoveToFront(element)
+	createdAt := entry.createdAt
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		// The file was removed in the meantime
+		c.removeKey(key)
+		return nil, time.Time{}, false
+	}
+
+	return data, createdAt, true
+}
+
+// Set stores the data for the key, evicting other entries if the cache is full
+func (c *DiskCache) Set(key string, data []byte) error {
+	key = hashKey(key)
+	path := c.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first and rename it, so readers never see partial files
+	file, err := os.CreateTemp(filepath.Dir(path), diskCacheTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.size -= element.Value.(*diskCacheEntry).size
+		c.lru.Remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(&diskCacheEntry{key: key, size: int64(len(data)), createdAt: time.Now()})
+	c.size += int64(len(data))
+	c.evict()
+
+	return nil
+}
+
+// Delete removes the entry for the key (e.g. when the cached data turns out to be invalid)
+func (c *DiskCache) Delete(key string) {
+	c.removeKey(hashKey(key))
+}
+
+func (c *DiskCache) removeKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
+	}
+}
+
+func (c *DiskCache) expired(entry *diskCacheEntry) bool {
+	return c.maxAge > 0 && time.Since(entry.createdAt) > c.maxAge
+}
+
+// evict removes the least recently used entries above the maximum size (expired entries are
+// removed on load and access). Must be called with the mutex held.
+func (c *DiskCache) evict() {
+	for c.maxSize > 0 && c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes an entry and its file. Must be called with the mutex held.
+func (c *DiskCache) remove(element *list.Element) {
+	entry := element.Value.(*diskCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	if err := os.Remove(c.path(entry.key)); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: failed to remove cached file %s: %v", entry.key, err)
+	}
+}
+
+// tileDiskCache is the optional second level cache for downloaded upstream tiles
+var tileDiskCache *DiskCache
+
+// ConfigureDiskCache enables the persistent cache for downloaded upstream tiles
+func ConfigureDiskCache(dir string, maxSize int64, maxAge time.Duration) error {
+	cache, err := NewDiskCache(dir, maxSize, maxAge)
+	if err != nil {
+		return err
+	}
+	tileDiskCache = cache
+	return nil
+}
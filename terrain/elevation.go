@@ -1,28 +1,60 @@
 package terrain
 
-// ElevationMap holds preprocessed elevation data for efficient access
+import "unsafe"
+
+// ElevationMap holds preprocessed elevation data for efficient access. The data can include
+// a buffer of pixels from the neighboring tiles on each side, so Data has TileSize+2*Buffer rows
+// and columns. All methods use tile coordinates, the buffer pixels are at negative coordinates
+// and at TileSize and above.
 type ElevationMap struct {
 	Data     [][]float32
 	TileSize int
+	Buffer   int
+}
+
+// newEmptyElevationMap creates an elevation map at sea level
+func newEmptyElevationMap(tileSize int) *ElevationMap {
+	data := make([][]float32, tileSize)
+	for y := range data {
+		data[y] = make([]float32, tileSize)
+	}
+	return &ElevationMap{
+		Data:     data,
+		TileSize: tileSize,
+	}
+}
+
+// sizeInBytes returns the approximate memory used by the elevation map
+func (em *ElevationMap) sizeInBytes() int64 {
+	size := int64(unsafe.Sizeof(*em)) + int64(len(em.Data))*int64(unsafe.Sizeof(em.Data[0]))
+	for _, row := range em.Data {
+		size += int64(cap(row)) * int64(unsafe.Sizeof(float32(0)))
+	}
+	return size
+}
+
+// InBounds returns true if the coordinates are within the tile or its buffer
+func (em *ElevationMap) InBounds(x, y int) bool {
+	return x >= -em.Buffer && y >= -em.Buffer && x < em.TileSize+em.Buffer && y < em.TileSize+em.Buffer
 }
 
 // GetElevation returns the elevation at the given coordinates
-// Returns 0 (sea level) for out of bounds coordinates
+// Returns 0 (sea level) for coordinates outside of the tile and its buffer
 func (em *ElevationMap) GetElevation(x, y int) float32 {
-	if x < 0 || y < 0 || x >= em.TileSize || y >= em.TileSize {
+	if !em.InBounds(x, y) {
 		return 0
 	}
-	return em.Data[y][x]
+	return em.Data[y+em.Buffer][x+em.Buffer]
 }
 
 // ModifyElevation modifies the elevation at the given coordinates (pixels)
 func (em *ElevationMap) ModifyElevation(x, y int, elevation float32) {
-	em.Data[y][x] = elevation
+	em.Data[y+em.Buffer][x+em.Buffer] = elevation
 }
 
 // IsAboveSeaLevel returns true if the elevation indicates land
 func (em *ElevationMap) IsAboveSeaLevel(x, y int) bool {
-	return em.Data[y][x] > 0
+	return em.GetElevation(x, y) > 0
 }
 
 // GetNeighborhood returns elevation values in a square neighborhood
@@ -40,14 +72,14 @@ func (em *ElevationMap) GetNeighborhood(x, y, radius int) []float32 {
 }
 
 // GetNeighborhoodStats returns the count of land and water pixels in a neighborhood
-// and a flag indicating if the neighborhood includes tile edges
+// and a flag indicating if the neighborhood exceeds the tile (and its buffer)
 func (em *ElevationMap) GetNeighborhoodStats(x, y, radius int) (landCount, waterCount int, hasEdge bool) {
 	for dy := -radius; dy <= radius; dy++ {
 		for dx := -radius; dx <= radius; dx++ {
 			newX, newY := x+dx, y+dy
 
-			// Check if we're at the tile edge
-			if newX < 0 || newY < 0 || newX >= em.TileSize || newY >= em.TileSize {
+			// Check if we're at the edge of the available data
+			if !em.InBounds(newX, newY) {
 				hasEdge = true
 				continue
 			}
@@ -0,0 +1,118 @@
+package terrain
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"sort"
+	"sync"
+
+	mono_terrain "github.com/mxzinke/colorful-terrarium/colors/mono-terrain"
+	_ "golang.org/x/image/webp"
+)
+
+// ElevationDecoder decodes the elevation of the pixels of an RGB/Gray encoded DEM tile
+type ElevationDecoder interface {
+	// Decode returns the elevation in meters for the color of a pixel
+	Decode(c color.Color) float32
+	// SeaLevel returns the color of a pixel with an elevation of 0 meters
+	SeaLevel() color.Color
+}
+
+// TerrariumDecoder decodes the Terrarium encoding (R*256 + G + B/256 - 32768)
+type TerrariumDecoder struct{}
+
+func (TerrariumDecoder) Decode(c color.Color) float32 {
+	r, g, b, _ := c.RGBA()
+	return float32(r>>8)*256.0 + float32(g>>8) + float32(b>>8)/256.0 - 32768.0
+}
+
+func (TerrariumDecoder) SeaLevel() color.Color {
+	return color.RGBA{R: 128, G: 0, B: 0, A: 255}
+}
+
+// TerrainRGBDecoder decodes the Mapbox Terrain-RGB encoding (-10000 + (R*65536 + G*256 + B) * 0.1)
+type TerrainRGBDecoder struct{}
+
+func (TerrainRGBDecoder) Decode(c color.Color) float32 {
+	r, g, b, _ := c.RGBA()
+	return -10000.0 + float32((r>>8)<<16|(g>>8)<<8|(b>>8))*0.1
+}
+
+func (TerrainRGBDecoder) SeaLevel() color.Color {
+	return color.RGBA{R: 1, G: 134, B: 160, A: 255}
+}
+
+// MonoTerrainDecoder decodes the Gray16 encoding of the mono-terrain color providers
+type MonoTerrainDecoder struct{}
+
+func (MonoTerrainDecoder) Decode(c color.Color) float32 {
+	return mono_terrain.DecodeElevationFromMonoTerrain(color.Gray16Model.Convert(c).(color.Gray16))
+}
+
+func (MonoTerrainDecoder) SeaLevel() color.Color {
+	return mono_terrain.EncodeElevationToMonoTerrain(0)
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]ElevationDecoder{
+		"terrarium":    TerrariumDecoder{},
+		"mapbox":       TerrainRGBDecoder{},
+		"terrain-rgb":  TerrainRGBDecoder{},
+		"mono-terrain": MonoTerrainDecoder{},
+	}
+)
+
+// RegisterElevationDecoder makes a decoder available for sources under the given encoding name
+func RegisterElevationDecoder(encoding string, decoder ElevationDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[encoding] = decoder
+}
+
+// GetElevationDecoder returns the decoder registered for the encoding name
+func GetElevationDecoder(encoding string) (ElevationDecoder, error) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	decoder, ok := decoders[encoding]
+	if !ok {
+		names := make([]string, 0, len(decoders))
+		for name := range decoders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown elevation encoding %q (available: %v)", encoding, names)
+	}
+
+	return decoder, nil
+}
+
+// newElevationMapFromImage creates a new ElevationMap from an encoded image
+func newElevationMapFromImage(img image.Image, decoder ElevationDecoder) *ElevationMap {
+	bounds := img.Bounds()
+	data := make([][]float32, bounds.Dy())
+
+	for y := 0; y < bounds.Dy(); y++ {
+		data[y] = make([]float32, bounds.Dx())
+		for x := 0; x < bounds.Dx(); x++ {
+			data[y][x] = decoder.Decode(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return &ElevationMap{
+		Data:     data,
+		TileSize: bounds.Dx(),
+	}
+}
+
+// newSeaLevelImage creates a tile image filled with the sea level color of the decoder
+func newSeaLevelImage(size int, decoder ElevationDecoder) image.Image {
+	img := image.NewRGBA64(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(decoder.SeaLevel()), image.Point{}, draw.Src)
+	return img
+}
@@ -6,17 +6,64 @@ import (
 	"fmt"
 	"image/color"
 	"io"
+	"log"
 	"net/http"
 
 	tiff "github.com/chai2010/tiff"
 )
 
-const geotiffSourceURL = "https://elevation-tiles-prod.s3.dualstack.us-east-1.amazonaws.com/geotiff/%d/%d/%d.tif"
+const geotiffSourceURL = "https://elevation-tiles-prod.s3.dualstack.us-east-1.amazonaws.com/geotiff/{z}/{x}/{y}.tif"
+
+// GeoTIFFSource fetches 16-bit GeoTIFF elevation tiles over HTTP
+type GeoTIFFSource struct {
+	url string
+}
+
+// NewGeoTIFFSource creates a source for the given URL template (with {z}/{x}/{y} placeholders)
+func NewGeoTIFFSource(url string) *GeoTIFFSource {
+	return &GeoTIFFSource{url: url}
+}
+
+func (s *GeoTIFFSource) Name() string {
+	return "geotiff"
+}
+
+func (s *GeoTIFFSource) MinZoom() uint32 {
+	return 0
+}
+
+func (s *GeoTIFFSource) MaxZoom() uint32 {
+	return 14
+}
+
+func (s *GeoTIFFSource) MaxTileZoom() uint32 {
+	return s.MaxZoom()
+}
+
+func (s *GeoTIFFSource) TileSize() int {
+	return 512
+}
+
+func (s *GeoTIFFSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if coord.Z > s.MaxZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+
+	return globalCache.GetOrCreate(ctx, s.url, coord, func(ctx context.Context) (*ElevationMap, error) {
+		url := formatTileTemplate(s.url, coord)
+		if tileDiskCache != nil {
+			if data, found := tileDiskCache.Get(url); found {
+				matrix, tileSize, err := readTIFFToFloat32Matrix(data)
+				if err == nil {
+					return &ElevationMap{Data: matrix, TileSize: tileSize}, nil
+				}
+				log.Printf("Invalid cached GeoTIFF %s: %v", url, err)
+				tileDiskCache.Delete(url)
+			}
+		}
 
-func GetElevationMapFromGeoTIFF(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
-	return globalCache.GetOrCreate(coord, func() (*ElevationMap, error) {
 		// If not in cache or expired, fetch new data
-		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(geotiffSourceURL, coord.Z, coord.X, coord.Y), nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request for GeoTIFF: %w", err)
 		}
@@ -42,6 +89,12 @@ func GetElevationMapFromGeoTIFF(ctx context.Context, coord TileCoord) (*Elevatio
 			return nil, fmt.Errorf("failed to decode TIFF: %v", err)
 		}
 
+		if tileDiskCache != nil {
+			if err := tileDiskCache.Set(url, data); err != nil {
+				log.Printf("WARNING: failed to write GeoTIFF %s to disk cache: %v", url, err)
+			}
+		}
+
 		// Copy over data to ElevationMap
 		return &ElevationMap{
 			Data:     matrix,
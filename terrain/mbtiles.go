@@ -0,0 +1,112 @@
+package terrain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// mbtilesArchive reads tiles from a local MBTiles (SQLite) archive
+type mbtilesArchive struct {
+	db       *sql.DB
+	minZoom  uint32
+	maxZoom  uint32
+	metadata map[string]string
+}
+
+func openMBTiles(path string) (*mbtilesArchive, error) {
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &mbtilesArchive{db: db, metadata: make(map[string]string)}
+	if err := archive.load(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read MBTiles %s: %w", path, err)
+	}
+
+	return archive, nil
+}
+
+func (a *mbtilesArchive) load() error {
+	rows, err := a.db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		a.metadata[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The zoom range in the metadata is optional, so we take it from the tiles
+	var minZoom, maxZoom sql.NullInt64
+	err = a.db.QueryRow("SELECT MIN(zoom_level), MAX(zoom_level) FROM tiles").Scan(&minZoom, &maxZoom)
+	if err != nil {
+		return err
+	}
+	if !minZoom.Valid || !maxZoom.Valid {
+		return errors.New("archive contains no tiles")
+	}
+
+	a.minZoom = uint32(minZoom.Int64)
+	a.maxZoom = uint32(maxZoom.Int64)
+
+	return nil
+}
+
+func (a *mbtilesArchive) MinZoom() uint32 {
+	return a.minZoom
+}
+
+func (a *mbtilesArchive) MaxZoom() uint32 {
+	return a.maxZoom
+}
+
+func (a *mbtilesArchive) Metadata(key string) string {
+	return a.metadata[key]
+}
+
+// ReadTile returns the tile data, or nil if the tile is not part of the archive
+func (a *mbtilesArchive) ReadTile(coord TileCoord) ([]byte, error) {
+	// MBTiles uses the TMS scheme, where the rows are counted from the south
+	row := (uint32(1) << coord.Z) - 1 - coord.Y
+
+	var data []byte
+	err := a.db.QueryRow(
+		"SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		coord.Z, coord.X, row,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// FirstTile returns the data of any tile in the archive
+func (a *mbtilesArchive) FirstTile() ([]byte, error) {
+	var data []byte
+	if err := a.db.QueryRow("SELECT tile_data FROM tiles LIMIT 1").Scan(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (a *mbtilesArchive) Close() error {
+	return a.db.Close()
+}
@@ -0,0 +1,91 @@
+package terrain
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestMBTiles writes a MBTiles archive of the tiles, with the rows in the TMS scheme (counted from the south)
+func writeTestMBTiles(t *testing.T, tiles map[TileCoord][]byte, metadata map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, statement := range []string{
+		"CREATE TABLE metadata (name TEXT, value TEXT)",
+		"CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)",
+		"CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, value := range metadata {
+		if _, err := db.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for coord, data := range tiles {
+		row := (uint32(1) << coord.Z) - 1 - coord.Y
+		if _, err := db.Exec("INSERT INTO tiles VALUES (?, ?, ?, ?)", coord.Z, coord.X, row, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestMBTilesReadTile(t *testing.T) {
+	tiles := map[TileCoord][]byte{
+		{Z: 1, X: 0, Y: 0}: []byte("1/0/0"),
+		{Z: 2, X: 1, Y: 0}: []byte("2/1/0"),
+		{Z: 2, X: 1, Y: 3}: []byte("2/1/3"),
+		{Z: 3, X: 5, Y: 2}: []byte("3/5/2"),
+	}
+	archive, err := openMBTiles(writeTestMBTiles(t, tiles, map[string]string{"name": "test"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	if archive.MinZoom() != 1 || archive.MaxZoom() != 3 {
+		t.Errorf("got zoom levels %d-%d, want 1-3 from the tiles", archive.MinZoom(), archive.MaxZoom())
+	}
+	if name := archive.Metadata("name"); name != "test" {
+		t.Errorf("got name %q from the metadata, want test", name)
+	}
+
+	// The rows are flipped, e.g. 2/1/0 is stored in row 3 and 2/1/3 in row 0
+	for coord, want := range tiles {
+		data, err := archive.ReadTile(coord)
+		if err != nil {
+			t.Fatalf("tile %v: %v", coord, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("tile %v: got %q, want %q", coord, data, want)
+		}
+	}
+
+	for _, coord := range []TileCoord{{Z: 1, X: 0, Y: 1}, {Z: 3, X: 5, Y: 5}, {Z: 4}} {
+		data, err := archive.ReadTile(coord)
+		if err != nil || data != nil {
+			t.Errorf("tile %v: got %q (error %v) for a missing tile, want none", coord, data, err)
+		}
+	}
+}
+
+func TestMBTilesSource(t *testing.T) {
+	source, err := NewMBTilesSource(writeTestMBTiles(t, testTiles(t, 2, 4), map[string]string{"encoding": "terrarium"}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	checkArchiveSource(t, source)
+}
@@ -0,0 +1,310 @@
+package terrain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	pmtilesHeaderSize      = 127
+	pmtilesMaxDirDepth     = 4
+	pmtilesCompressNone    = 1
+	pmtilesCompressGzip    = 2
+	pmtilesCompressUnknown = 0
+)
+
+// pmtilesHeader contains the relevant fields of a PMTiles v3 header
+type pmtilesHeader struct {
+	rootOffset, rootLength         uint64
+	metadataOffset, metadataLength uint64
+	leafOffset, leafLength         uint64
+	dataOffset, dataLength         uint64
+	internalCompression            uint8
+	tileCompression                uint8
+	minZoom, maxZoom               uint8
+}
+
+// pmtilesEntry is a single (run-length encoded) entry of a PMTiles directory
+type pmtilesEntry struct {
+	tileID    uint64
+	offset    uint64
+	length    uint32
+	runLength uint32
+}
+
+// pmtilesArchive reads tiles from a local PMTiles v3 archive
+type pmtilesArchive struct {
+	file     *os.File
+	header   pmtilesHeader
+	root     []pmtilesEntry
+	metadata map[string]any
+}
+
+func openPMTiles(path string) (*pmtilesArchive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &pmtilesArchive{file: file}
+	if err := archive.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read PMTiles %s: %w", path, err)
+	}
+
+	return archive, nil
+}
+
+func (a *pmtilesArchive) load() error {
+	buf := make([]byte, pmtilesHeaderSize)
+	if _, err := a.file.ReadAt(buf, 0); err != nil {
+		return err
+	}
+
+	if string(buf[0:7]) != "PMTiles" {
+		return errors.New("not a PMTiles archive")
+	}
+	if buf[7] != 3 {
+		return fmt.Errorf("unsupported PMTiles version %d", buf[7])
+	}
+
+	a.header = pmtilesHeader{
+		rootOffset:          binary.LittleEndian.Uint64(buf[8:16]),
+		rootLength:          binary.LittleEndian.Uint64(buf[16:24]),
+		metadataOffset:      binary.LittleEndian.Uint64(buf[24:32]),
+		metadataLength:      binary.LittleEndian.Uint64(buf[32:40]),
+		leafOffset:          binary.LittleEndian.Uint64(buf[40:48]),
+		leafLength:          binary.LittleEndian.Uint64(buf[48:56]),
+		dataOffset:          binary.LittleEndian.Uint64(buf[56:64]),
+		dataLength:          binary.LittleEndian.Uint64(buf[64:72]),
+		internalCompression: buf[97],
+		tileCompression:     buf[98],
+		minZoom:             buf[100],
+		maxZoom:             buf[101],
+	}
+
+	root, err := a.readDirectory(a.header.rootOffset, a.header.rootLength)
+	if err != nil {
+		return fmt.Errorf("failed to read root directory: %w", err)
+	}
+	a.root = root
+
+	if a.header.metadataLength > 0 {
+		data, err := a.readSection(a.header.metadataOffset, a.header.metadataLength, a.header.internalCompression)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata: %w", err)
+		}
+		if err := json.Unmarshal(data, &a.metadata); err != nil {
+			return fmt.Errorf("failed to parse metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (a *pmtilesArchive) MinZoom() uint32 {
+	return uint32(a.header.minZoom)
+}
+
+func (a *pmtilesArchive) MaxZoom() uint32 {
+	return uint32(a.header.maxZoom)
+}
+
+func (a *pmtilesArchive) Metadata(key string) string {
+	if value, ok := a.metadata[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// ReadTile returns the tile data, or nil if the tile is not part of the archive
+func (a *pmtilesArchive) ReadTile(coord TileCoord) ([]byte, error) {
+	tileID := pmtilesTileID(coord)
+
+	entries := a.root
+	for depth := 0; depth < pmtilesMaxDirDepth; depth++ {
+		entry, ok := pmtilesFindEntry(entries, tileID)
+		if !ok {
+			return nil, nil
+		}
+
+		if entry.runLength > 0 {
+			return a.readSection(a.header.dataOffset+entry.offset, uint64(entry.length), a.header.tileCompression)
+		}
+
+		// A run length of 0 points to a leaf directory
+		leaf, err := a.readDirectory(a.header.leafOffset+entry.offset, uint64(entry.length))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read leaf directory: %w", err)
+		}
+		entries = leaf
+	}
+
+	return nil, errors.New("maximum directory depth exceeded")
+}
+
+// FirstTile returns the data of the first tile in the archive
+func (a *pmtilesArchive) FirstTile() ([]byte, error) {
+	entries := a.root
+	for depth := 0; depth < pmtilesMaxDirDepth && len(entries) > 0; depth++ {
+		entry := entries[0]
+		if entry.runLength > 0 {
+			return a.readSection(a.header.dataOffset+entry.offset, uint64(entry.length), a.header.tileCompression)
+		}
+
+		leaf, err := a.readDirectory(a.header.leafOffset+entry.offset, uint64(entry.length))
+		if err != nil {
+			return nil, err
+		}
+		entries = leaf
+	}
+
+	return nil, errors.New("archive contains no tiles")
+}
+
+func (a *pmtilesArchive) Close() error {
+	return a.file.Close()
+}
+
+// readSection reads and decompresses a part of the archive
+func (a *pmtilesArchive) readSection(offset, length uint64, compression uint8) ([]byte, error) {
+	data := make([]byte, length)
+	if _, err := a.file.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case pmtilesCompressNone, pmtilesCompressUnknown:
+		return data, nil
+	case pmtilesCompressGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	return nil, fmt.Errorf("unsupported compression %d", compression)
+}
+
+// readDirectory reads a directory, which is stored column-wise as varints
+func (a *pmtilesArchive) readDirectory(offset, length uint64) ([]pmtilesEntry, error) {
+	data, err := a.readSection(offset, length, a.header.internalCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]pmtilesEntry, count)
+
+	// Tile IDs are delta encoded
+	var lastID uint64
+	for i := range entries {
+		value, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		lastID += value
+		entries[i].tileID = lastID
+	}
+
+	for i := range entries {
+		value, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].runLength = uint32(value)
+	}
+
+	for i := range entries {
+		value, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].length = uint32(value)
+	}
+
+	// An offset of 0 means the entry directly follows the previous one
+	for i := range entries {
+		value, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		if value == 0 && i > 0 {
+			entries[i].offset = entries[i-1].offset + uint64(entries[i-1].length)
+		} else {
+			entries[i].offset = value - 1
+		}
+	}
+
+	return entries, nil
+}
+
+// pmtilesFindEntry searches the entry containing the tile ID (or the leaf directory for it)
+func pmtilesFindEntry(entries []pmtilesEntry, tileID uint64) (pmtilesEntry, bool) {
+	low, high := 0, len(entries)-1
+	for low <= high {
+		mid := (low + high) / 2
+		switch {
+		case tileID > entries[mid].tileID:
+			low = mid + 1
+		case tileID < entries[mid].tileID:
+			high = mid - 1
+		default:
+			return entries[mid], true
+		}
+	}
+
+	// high is now the last entry with a smaller tile ID
+	if high >= 0 {
+		entry := entries[high]
+		if entry.runLength == 0 || tileID-entry.tileID < uint64(entry.runLength) {
+			return entry, true
+		}
+	}
+
+	return pmtilesEntry{}, false
+}
+
+// pmtilesTileID converts a tile coordinate to the position on the hilbert curve over all zoom levels
+func pmtilesTileID(coord TileCoord) uint64 {
+	var id uint64
+	for z := uint32(0); z < coord.Z; z++ {
+		id += uint64(1) << (2 * z)
+	}
+
+	x, y := uint64(coord.X), uint64(coord.Y)
+	for s := uint64(1) << coord.Z >> 1; s > 0; s >>= 1 {
+		var rx, ry uint64
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		id += s * s * ((3 * rx) ^ ry)
+
+		// Rotate the quadrant
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+
+	return id
+}
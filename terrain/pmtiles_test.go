@@ -0,0 +1,204 @@
+package terrain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestPMTiles writes a PMTiles v3 archive of the tiles, equal tiles with consecutive IDs are stored as run.
+// With a leaf size, the entries are split into leaf directories of that many entries.
+func writeTestPMTiles(t *testing.T, tiles map[TileCoord][]byte, leafSize int, compression uint8) string {
+	t.Helper()
+
+	compress := func(data []byte) []byte {
+		if compression != pmtilesCompressGzip {
+			return data
+		}
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(data)
+		writer.Close()
+		return buf.Bytes()
+	}
+
+	coords := make([]TileCoord, 0, len(tiles))
+	minZoom, maxZoom := uint32(255), uint32(0)
+	for coord := range tiles {
+		coords = append(coords, coord)
+		minZoom, maxZoom = min(minZoom, coord.Z), max(maxZoom, coord.Z)
+	}
+	sort.Slice(coords, func(i, j int) bool { return pmtilesTileID(coords[i]) < pmtilesTileID(coords[j]) })
+
+	var data []byte
+	var entries []pmtilesEntry
+	for _, coord := range coords {
+		id := pmtilesTileID(coord)
+		if n := len(entries); n > 0 {
+			last := &entries[n-1]
+			if last.tileID+uint64(last.runLength) == id && bytes.Equal(tiles[coord], data[last.offset:last.offset+uint64(last.length)]) {
+				last.runLength++
+				continue
+			}
+		}
+		entries = append(entries, pmtilesEntry{tileID: id, offset: uint64(len(data)), length: uint32(len(tiles[coord])), runLength: 1})
+		data = append(data, tiles[coord]...)
+	}
+
+	root := entries
+	var leaves []byte
+	if leafSize > 0 {
+		root = nil
+		for start := 0; start < len(entries); start += leafSize {
+			leaf := compress(encodeTestPMTilesDirectory(entries[start:min(start+leafSize, len(entries))]))
+			root = append(root, pmtilesEntry{tileID: entries[start].tileID, offset: uint64(len(leaves)), length: uint32(len(leaf))})
+			leaves = append(leaves, leaf...)
+		}
+	}
+
+	rootData := compress(encodeTestPMTilesDirectory(root))
+	metadata := compress([]byte(`{"name":"test","encoding":"terrarium"}`))
+
+	header := make([]byte, pmtilesHeaderSize)
+	copy(header, "PMTiles")
+	header[7] = 3
+	offset := uint64(pmtilesHeaderSize)
+	for i, section := range [][]byte{rootData, metadata, leaves, data} {
+		binary.LittleEndian.PutUint64(header[8+i*16:], offset)
+		binary.LittleEndian.PutUint64(header[16+i*16:], uint64(len(section)))
+		offset += uint64(len(section))
+	}
+	binary.LittleEndian.PutUint64(header[72:], uint64(len(coords)))
+	binary.LittleEndian.PutUint64(header[80:], uint64(len(entries)))
+	header[96] = 1
+	header[97] = compression
+	header[98] = pmtilesCompressNone
+	header[99] = 2 // PNG
+	header[100], header[101] = uint8(minZoom), uint8(maxZoom)
+
+	path := filepath.Join(t.TempDir(), "test.pmtiles")
+	file := bytes.Join([][]byte{header, rootData, metadata, leaves, data}, nil)
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encodeTestPMTilesDirectory encodes the entries column-wise as varints, offsets of entries directly following
+// the previous one as 0
+func encodeTestPMTilesDirectory(entries []pmtilesEntry) []byte {
+	data := binary.AppendUvarint(nil, uint64(len(entries)))
+	var lastID uint64
+	for _, entry := range entries {
+		data = binary.AppendUvarint(data, entry.tileID-lastID)
+		lastID = entry.tileID
+	}
+	for _, entry := range entries {
+		data = binary.AppendUvarint(data, uint64(entry.runLength))
+	}
+	for _, entry := range entries {
+		data = binary.AppendUvarint(data, uint64(entry.length))
+	}
+	for i, entry := range entries {
+		if i > 0 && entry.offset == entries[i-1].offset+uint64(entries[i-1].length) {
+			data = binary.AppendUvarint(data, 0)
+		} else {
+			data = binary.AppendUvarint(data, entry.offset+1)
+		}
+	}
+	return data
+}
+
+func TestPMTilesTileID(t *testing.T) {
+	// The IDs of the specification and its reference implementation
+	tests := []struct {
+		coord TileCoord
+		id    uint64
+	}{
+		{TileCoord{Z: 0, X: 0, Y: 0}, 0},
+		{TileCoord{Z: 1, X: 0, Y: 0}, 1},
+		{TileCoord{Z: 1, X: 0, Y: 1}, 2},
+		{TileCoord{Z: 1, X: 1, Y: 1}, 3},
+		{TileCoord{Z: 1, X: 1, Y: 0}, 4},
+		{TileCoord{Z: 2, X: 0, Y: 0}, 5},
+		{TileCoord{Z: 2, X: 3, Y: 0}, 20},
+		{TileCoord{Z: 3, X: 7, Y: 0}, 84},
+		{TileCoord{Z: 12, X: 3423, Y: 1763}, 19078479},
+	}
+	for _, test := range tests {
+		if id := pmtilesTileID(test.coord); id != test.id {
+			t.Errorf("tile %v: got ID %d, want %d", test.coord, id, test.id)
+		}
+	}
+}
+
+func TestPMTilesReadTile(t *testing.T) {
+	tiles := testTiles(t, 3, 4)
+
+	// Equal tiles with consecutive IDs (1/0/0 and 1/0/1) are stored as run
+	tiles[TileCoord{Z: 1, X: 0, Y: 1}] = tiles[TileCoord{Z: 1, X: 0, Y: 0}]
+
+	tests := []struct {
+		name        string
+		leafSize    int
+		compression uint8
+	}{
+		{"root directory", 0, pmtilesCompressNone},
+		{"leaf directories", 7, pmtilesCompressNone},
+		{"compressed leaf directories", 7, pmtilesCompressGzip},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archive, err := openPMTiles(writeTestPMTiles(t, tiles, test.leafSize, test.compression))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.Close()
+
+			if archive.MinZoom() != 0 || archive.MaxZoom() != 3 {
+				t.Errorf("got zoom levels %d-%d, want 0-3", archive.MinZoom(), archive.MaxZoom())
+			}
+			if name := archive.Metadata("name"); name != "test" {
+				t.Errorf("got name %q from the metadata, want test", name)
+			}
+			if test.leafSize > 0 && len(archive.root) != (len(tiles)-1+test.leafSize-1)/test.leafSize {
+				t.Errorf("got %d root entries, want the leaf directories", len(archive.root))
+			}
+
+			for coord, want := range tiles {
+				data, err := archive.ReadTile(coord)
+				if err != nil {
+					t.Fatalf("tile %v: %v", coord, err)
+				}
+				if !bytes.Equal(data, want) {
+					t.Errorf("tile %v: got %d bytes, want the %d bytes of the tile", coord, len(data), len(want))
+				}
+			}
+
+			data, err := archive.ReadTile(TileCoord{Z: 4, X: 3, Y: 5})
+			if err != nil || data != nil {
+				t.Errorf("got %d bytes (error %v) for a missing tile, want none", len(data), err)
+			}
+
+			first, err := archive.FirstTile()
+			if err != nil || !bytes.Equal(first, tiles[TileCoord{}]) {
+				t.Errorf("got %d bytes (error %v) as first tile, want tile 0/0/0", len(first), err)
+			}
+		})
+	}
+}
+
+func TestPMTilesSource(t *testing.T) {
+	source, err := NewPMTilesSource(writeTestPMTiles(t, testTiles(t, 2, 4), 5, pmtilesCompressGzip), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	checkArchiveSource(t, source)
+}
@@ -0,0 +1,318 @@
+package terrain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+)
+
+// WGS84 ellipsoid of the quantized-mesh positions
+const (
+	wgs84RadiusA        = 6378137.0
+	wgs84RadiusB        = 6356752.3142451793
+	wgs84Eccentricity2  = 1 - (wgs84RadiusB*wgs84RadiusB)/(wgs84RadiusA*wgs84RadiusA)
+	quantizedMeshMaxPos = 32767
+)
+
+// Extension IDs of quantized-mesh-1.0
+const (
+	quantizedMeshOctVertexNormals = 1
+	quantizedMeshWaterMask        = 2
+)
+
+// QuantizedMeshWaterMaskSize is the width and height of a water mask
+const QuantizedMeshWaterMaskSize = 256
+
+// MeshVertex is a vertex of a terrain mesh, U (eastwards) and V (northwards) are between 0 and 1 within the tile
+type MeshVertex struct {
+	U, V   float64
+	Height float64
+}
+
+// QuantizedMesh is a terrain tile in the quantized-mesh-1.0 format of Cesium
+// (https://github.com/CesiumGS/quantized-mesh)
+type QuantizedMesh struct {
+	// Bound is the tile in degrees
+	Bound     orb.Bound
+	Vertices  []MeshVertex
+	Triangles [][3]int
+	// Normals adds the oct-encoded vertex normals extension
+	Normals bool
+	// WaterMask adds the water mask extension, with a single byte (0 land, 255 water) or 256x256 bytes
+	// from north-west to south-east
+	WaterMask []byte
+}
+
+// Encode writes the mesh, triangles are turned counter-clockwise if needed
+func (m *QuantizedMesh) Encode(w io.Writer) error {
+	if len(m.Vertices) == 0 || len(m.Vertices) > math.MaxUint16+1 {
+		return fmt.Errorf("unsupported vertex count %d", len(m.Vertices))
+	}
+	if m.WaterMask != nil && len(m.WaterMask) != 1 && len(m.WaterMask) != QuantizedMeshWaterMaskSize*QuantizedMeshWaterMaskSize {
+		return fmt.Errorf("invalid water mask size %d", len(m.WaterMask))
+	}
+
+	vertices, triangles := m.ordered()
+
+	minHeight, maxHeight := math.Inf(1), math.Inf(-1)
+	for _, vertex := range vertices {
+		minHeight = math.Min(minHeight, vertex.Height)
+		maxHeight = math.Max(maxHeight, vertex.Height)
+	}
+
+	positions := make([][3]float64, len(vertices))
+	for i, vertex := range vertices {
+		positions[i] = m.position(vertex)
+	}
+
+	writer := bufio.NewWriter(w)
+	write := func(values ...any) {
+		for _, value := range values {
+			binary.Write(writer, binary.LittleEndian, value)
+		}
+	}
+
+	// Header
+	center := geodeticToECEF((m.Bound.Min[0]+m.Bound.Max[0])/2, (m.Bound.Min[1]+m.Bound.Max[1])/2, (minHeight+maxHeight)/2)
+	radius := 0.0
+	for _, position := range positions {
+		radius = math.Max(radius, distance(center, position))
+	}
+	occlusion := horizonOcclusionPoint(center, positions)
+
+	write(center, float32(minHeight), float32(maxHeight), center, radius, occlusion)
+
+	// Vertices, quantized and zig-zag delta encoded
+	quantized := make([][3]uint16, len(vertices))
+	for i, vertex := range vertices {
+		quantized[i] = [3]uint16{quantize(vertex.U), quantize(vertex.V), 0}
+		if maxHeight > minHeight {
+			quantized[i][2] = quantize((vertex.Height - minHeight) / (maxHeight - minHeight))
+		}
+	}
+
+	write(uint32(len(vertices)))
+	for component := 0; component < 3; component++ {
+		previous := 0
+		for _, vertex := range quantized {
+			delta := int(vertex[component]) - previous
+			previous = int(vertex[component])
+			write(uint16((delta << 1) ^ (delta >> 15)))
+		}
+	}
+
+	// Triangles, high water mark encoded (the vertices are at most 65536, so the indices are 16 bit)
+	write(uint32(len(triangles)))
+	highest := 0
+	for _, triangle := range triangles {
+		for _, index := range triangle {
+			write(uint16(highest - index))
+			if index == highest {
+				highest++
+			}
+		}
+	}
+
+	// Edge vertices (west, south, east, north), ordered along the edge
+	edge := func(component int, value uint16, orderBy int) {
+		var indices []uint16
+		for i, vertex := range quantized {
+			if vertex[component] == value {
+				indices = append(indices, uint16(i))
+			}
+		}
+		sort.Slice(indices, func(i, j int) bool { return quantized[indices[i]][orderBy] < quantized[indices[j]][orderBy] })
+		write(uint32(len(indices)), indices)
+	}
+	edge(0, 0, 1)
+	edge(1, 0, 0)
+	edge(0, quantizedMeshMaxPos, 1)
+	edge(1, quantizedMeshMaxPos, 0)
+
+	if m.Normals {
+		normals := vertexNormals(positions, triangles)
+		write(uint8(quantizedMeshOctVertexNormals), uint32(2*len(normals)))
+		for _, normal := range normals {
+			write(octEncode(normal))
+		}
+	}
+
+	if m.WaterMask != nil {
+		write(uint8(quantizedMeshWaterMask), uint32(len(m.WaterMask)), m.WaterMask)
+	}
+
+	return writer.Flush()
+}
+
+// ordered returns the triangles counter-clockwise and the vertices in the order of their first use by the
+// triangles, as needed by the high water mark encoding
+func (m *QuantizedMesh) ordered() ([]MeshVertex, [][3]int) {
+	order := make([]int, len(m.Vertices))
+	for i := range order {
+		order[i] = -1
+	}
+
+	vertices := make([]MeshVertex, 0, len(m.Vertices))
+	triangles := make([][3]int, len(m.Triangles))
+	for i, triangle := range m.Triangles {
+		a, b, c := m.Vertices[triangle[0]], m.Vertices[triangle[1]], m.Vertices[triangle[2]]
+		if (b.U-a.U)*(c.V-a.V)-(b.V-a.V)*(c.U-a.U) < 0 {
+			triangle[1], triangle[2] = triangle[2], triangle[1]
+		}
+
+		for j, index := range triangle {
+			if order[index] < 0 {
+				order[index] = len(vertices)
+				vertices = append(vertices, m.Vertices[index])
+			}
+			triangles[i][j] = order[index]
+		}
+	}
+
+	// Vertices without triangles are kept at the end
+	for index, vertex := range m.Vertices {
+		if order[index] < 0 {
+			vertices = append(vertices, vertex)
+		}
+	}
+	return vertices, triangles
+}
+
+// position returns the earth-centered, earth-fixed position of the vertex
+func (m *QuantizedMesh) position(vertex MeshVertex) [3]float64 {
+	lng := m.Bound.Min[0] + vertex.U*(m.Bound.Max[0]-m.Bound.Min[0])
+	lat := m.Bound.Min[1] + vertex.V*(m.Bound.Max[1]-m.Bound.Min[1])
+	return geodeticToECEF(lng, lat, vertex.Height)
+}
+
+func quantize(value float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(1, value)) * quantizedMeshMaxPos))
+}
+
+// geodeticToECEF converts a location on the WGS84 ellipsoid to earth-centered, earth-fixed coordinates
+func geodeticToECEF(lng, lat, height float64) [3]float64 {
+	lngRad, latRad := lng*math.Pi/180, lat*math.Pi/180
+	sinLat, cosLat := math.Sincos(latRad)
+	n := wgs84RadiusA / math.Sqrt(1-wgs84Eccentricity2*sinLat*sinLat)
+	return [3]float64{
+		(n + height) * cosLat * math.Cos(lngRad),
+		(n + height) * cosLat * math.Sin(lngRad),
+		(n*(1-wgs84Eccentricity2) + height) * sinLat,
+	}
+}
+
+// horizonOcclusionPoint calculates the point (in the ellipsoid-scaled frame) which is hidden behind the horizon
+// only if all positions are, as the EllipsoidalOccluder of Cesium
+func horizonOcclusionPoint(center [3]float64, positions [][3]float64) [3]float64 {
+	scale := [3]float64{1 / wgs84RadiusA, 1 / wgs84RadiusA, 1 / wgs84RadiusB}
+	direction := normalize(multiply(center, scale))
+
+	maxMagnitude := 0.0
+	for _, position := range positions {
+		scaled := multiply(position, scale)
+		magnitudeSquared := dot(scaled, scaled)
+		magnitude := math.Sqrt(magnitudeSquared)
+		positionDirection := normalize(scaled)
+
+		// Positions below the ellipsoid are treated as on it
+		magnitudeSquared = math.Max(1, magnitudeSquared)
+		magnitude = math.Max(1, magnitude)
+
+		cosAlpha := dot(positionDirection, direction)
+		sinAlpha := length(crossProduct(positionDirection, direction))
+		cosBeta := 1 / magnitude
+		sinBeta := math.Sqrt(magnitudeSquared-1) * cosBeta
+
+		denominator := cosAlpha*cosBeta - sinAlpha*sinBeta
+		if denominator <= 0 {
+			// The position is beyond the horizon of any point in the direction
+			continue
+		}
+		maxMagnitude = math.Max(maxMagnitude, 1/denominator)
+	}
+
+	return [3]float64{direction[0] * maxMagnitude, direction[1] * maxMagnitude, direction[2] * maxMagnitude}
+}
+
+// vertexNormals averages the normals of the triangles around each vertex, weighted by their area
+func vertexNormals(positions [][3]float64, triangles [][3]int) [][3]float64 {
+	normals := make([][3]float64, len(positions))
+	for _, triangle := range triangles {
+		a, b, c := positions[triangle[0]], positions[triangle[1]], positions[triangle[2]]
+		// Counter-clockwise triangles face away from the earth center
+		normal := crossProduct(subtract(b, a), subtract(c, a))
+		for _, index := range triangle {
+			for i := range normal {
+				normals[index][i] += normal[i]
+			}
+		}
+	}
+
+	for i, normal := range normals {
+		if length(normal) == 0 {
+			// Vertices without triangles point away from the earth center
+			normal = positions[i]
+		}
+		normals[i] = normalize(normal)
+	}
+	return normals
+}
+
+// octEncode encodes a unit vector into 2 bytes (octahedron projection)
+func octEncode(normal [3]float64) [2]uint8 {
+	sum := math.Abs(normal[0]) + math.Abs(normal[1]) + math.Abs(normal[2])
+	x, y := normal[0]/sum, normal[1]/sum
+	if normal[2] < 0 {
+		x, y = (1-math.Abs(y))*signNotZero(x), (1-math.Abs(x))*signNotZero(y)
+	}
+
+	toByte := func(value float64) uint8 {
+		return uint8(math.Round((math.Max(-1, math.Min(1, value))*0.5 + 0.5) * 255))
+	}
+	return [2]uint8{toByte(x), toByte(y)}
+}
+
+func signNotZero(value float64) float64 {
+	if value < 0 {
+		return -1
+	}
+	return 1
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func length(a [3]float64) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+func distance(a, b [3]float64) float64 {
+	return length(subtract(a, b))
+}
+
+func normalize(a [3]float64) [3]float64 {
+	l := length(a)
+	return [3]float64{a[0] / l, a[1] / l, a[2] / l}
+}
+
+func subtract(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func multiply(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] * b[0], a[1] * b[1], a[2] * b[2]}
+}
+
+func crossProduct(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
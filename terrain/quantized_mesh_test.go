@@ -0,0 +1,230 @@
+package terrain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+// decodedQuantizedMesh is a decoded quantized-mesh-1.0 tile
+type decodedQuantizedMesh struct {
+	center                 [3]float64
+	minHeight, maxHeight   float32
+	sphereCenter           [3]float64
+	sphereRadius           float64
+	occlusion              [3]float64
+	vertices               [][3]uint16
+	triangles              [][3]int
+	west, south, east, top []uint16
+	extensions             map[uint8][]byte
+}
+
+// decodeQuantizedMesh decodes a tile with 16 bit indices
+func decodeQuantizedMesh(t *testing.T, data []byte) *decodedQuantizedMesh {
+	t.Helper()
+
+	reader := bytes.NewReader(data)
+	read := func(values ...any) {
+		for _, value := range values {
+			if err := binary.Read(reader, binary.LittleEndian, value); err != nil {
+				t.Fatalf("failed to decode mesh: %v", err)
+			}
+		}
+	}
+
+	mesh := &decodedQuantizedMesh{extensions: map[uint8][]byte{}}
+	read(&mesh.center, &mesh.minHeight, &mesh.maxHeight, &mesh.sphereCenter, &mesh.sphereRadius, &mesh.occlusion)
+
+	var vertexCount uint32
+	read(&vertexCount)
+	mesh.vertices = make([][3]uint16, vertexCount)
+	for component := 0; component < 3; component++ {
+		value := 0
+		for i := range mesh.vertices {
+			var encoded uint16
+			read(&encoded)
+			value += int(encoded>>1) ^ -int(encoded&1)
+			mesh.vertices[i][component] = uint16(value)
+		}
+	}
+
+	var triangleCount uint32
+	read(&triangleCount)
+	mesh.triangles = make([][3]int, triangleCount)
+	highest := 0
+	for i := range mesh.triangles {
+		for j := range mesh.triangles[i] {
+			var code uint16
+			read(&code)
+			mesh.triangles[i][j] = highest - int(code)
+			if code == 0 {
+				highest++
+			}
+		}
+	}
+
+	for _, edge := range []*[]uint16{&mesh.west, &mesh.south, &mesh.east, &mesh.top} {
+		var count uint32
+		read(&count)
+		*edge = make([]uint16, count)
+		read(*edge)
+	}
+
+	for {
+		var id uint8
+		if err := binary.Read(reader, binary.LittleEndian, &id); err == io.EOF {
+			break
+		}
+		var length uint32
+		read(&length)
+		mesh.extensions[id] = make([]byte, length)
+		read(mesh.extensions[id])
+	}
+	return mesh
+}
+
+func TestQuantizedMeshRoundTrip(t *testing.T) {
+	const gridSize = 17
+	heights := testHeights(gridSize)
+	grid, err := TriangulateGrid(heights, gridSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mesh := &QuantizedMesh{
+		Bound:     orb.Bound{Min: orb.Point{8, 46}, Max: orb.Point{8.5, 46.5}},
+		Triangles: grid.Triangles,
+		Normals:   true,
+		WaterMask: []byte{255},
+	}
+	minHeight, maxHeight := math.Inf(1), math.Inf(-1)
+	for _, vertex := range grid.Vertices {
+		height := float64(heights[vertex[1]*gridSize+vertex[0]])
+		mesh.Vertices = append(mesh.Vertices, MeshVertex{
+			U:      float64(vertex[0]) / (gridSize - 1),
+			V:      1 - float64(vertex[1])/(gridSize-1),
+			Height: height,
+		})
+		minHeight, maxHeight = math.Min(minHeight, height), math.Max(maxHeight, height)
+	}
+
+	var buf bytes.Buffer
+	if err := mesh.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := decodeQuantizedMesh(t, buf.Bytes())
+
+	if float64(decoded.minHeight) != float64(float32(minHeight)) || float64(decoded.maxHeight) != float64(float32(maxHeight)) {
+		t.Errorf("got heights %v-%v, want %v-%v", decoded.minHeight, decoded.maxHeight, minHeight, maxHeight)
+	}
+	if want := geodeticToECEF(8.25, 46.25, (minHeight+maxHeight)/2); distance(decoded.center, want) > 1e-6 {
+		t.Errorf("got center %v, want %v", decoded.center, want)
+	}
+	if len(decoded.vertices) != len(mesh.Vertices) || len(decoded.triangles) != len(mesh.Triangles) {
+		t.Fatalf("got %d vertices and %d triangles, want %d and %d",
+			len(decoded.vertices), len(decoded.triangles), len(mesh.Vertices), len(mesh.Triangles))
+	}
+
+	// The vertices are reordered, so they are compared by position
+	vertexAt := func(u, v uint16) (MeshVertex, bool) {
+		for _, vertex := range mesh.Vertices {
+			if quantize(vertex.U) == u && quantize(vertex.V) == v {
+				return vertex, true
+			}
+		}
+		return MeshVertex{}, false
+	}
+	for i, quantized := range decoded.vertices {
+		vertex, ok := vertexAt(quantized[0], quantized[1])
+		if !ok {
+			t.Fatalf("vertex %d: got position %d/%d, which isn't a vertex of the mesh", i, quantized[0], quantized[1])
+		}
+		height := minHeight + float64(quantized[2])/quantizedMeshMaxPos*(maxHeight-minHeight)
+		if math.Abs(height-vertex.Height) > (maxHeight-minHeight)/quantizedMeshMaxPos {
+			t.Errorf("vertex %d: got height %v, want %v", i, height, vertex.Height)
+		}
+
+		position := geodeticToECEF(8+vertex.U*0.5, 46+vertex.V*0.5, vertex.Height)
+		if distance(decoded.sphereCenter, position) > decoded.sphereRadius+1e-6 {
+			t.Errorf("vertex %d: outside of the bounding sphere", i)
+		}
+	}
+
+	// The triangles cover the same positions, counter-clockwise
+	triangles := make(map[[3][2]uint16]bool)
+	for _, triangle := range mesh.Triangles {
+		var key [3][2]uint16
+		for i, index := range triangle {
+			key[i] = [2]uint16{quantize(mesh.Vertices[index].U), quantize(mesh.Vertices[index].V)}
+		}
+		triangles[key] = true
+		triangles[[3][2]uint16{key[0], key[2], key[1]}] = true
+	}
+	for i, triangle := range decoded.triangles {
+		var key [3][2]uint16
+		for j, index := range triangle {
+			key[j] = [2]uint16{decoded.vertices[index][0], decoded.vertices[index][1]}
+		}
+		if !triangles[key] {
+			t.Errorf("triangle %d: got %v, which isn't a triangle of the mesh", i, key)
+		}
+		a, b, c := key[0], key[1], key[2]
+		if (int(b[0])-int(a[0]))*(int(c[1])-int(a[1]))-(int(b[1])-int(a[1]))*(int(c[0])-int(a[0])) <= 0 {
+			t.Errorf("triangle %d: got clockwise triangle %v", i, key)
+		}
+	}
+
+	// Edges are all vertices on the tile border, ordered along the edge
+	edges := []struct {
+		name      string
+		indices   []uint16
+		component int
+		value     uint16
+	}{
+		{"west", decoded.west, 0, 0},
+		{"south", decoded.south, 1, 0},
+		{"east", decoded.east, 0, quantizedMeshMaxPos},
+		{"north", decoded.top, 1, quantizedMeshMaxPos},
+	}
+	for _, edge := range edges {
+		count := 0
+		for _, vertex := range decoded.vertices {
+			if vertex[edge.component] == edge.value {
+				count++
+			}
+		}
+		if len(edge.indices) != count || count < 2 {
+			t.Errorf("%s edge: got %d vertices, want %d", edge.name, len(edge.indices), count)
+		}
+		for i, index := range edge.indices {
+			if decoded.vertices[index][edge.component] != edge.value {
+				t.Errorf("%s edge: vertex %d isn't on the edge", edge.name, index)
+			}
+			if i > 0 && decoded.vertices[index][1-edge.component] <= decoded.vertices[edge.indices[i-1]][1-edge.component] {
+				t.Errorf("%s edge: vertices aren't ordered along the edge", edge.name)
+			}
+		}
+	}
+
+	if normals := decoded.extensions[quantizedMeshOctVertexNormals]; len(normals) != 2*len(decoded.vertices) {
+		t.Errorf("got %d bytes of normals, want 2 per vertex", len(normals))
+	}
+	if waterMask := decoded.extensions[quantizedMeshWaterMask]; !bytes.Equal(waterMask, mesh.WaterMask) {
+		t.Errorf("got water mask %v, want %v", waterMask, mesh.WaterMask)
+	}
+}
+
+func TestQuantizedMeshEncodeInvalid(t *testing.T) {
+	for _, mesh := range []*QuantizedMesh{
+		{},
+		{Vertices: []MeshVertex{{}}, WaterMask: make([]byte, 16)},
+	} {
+		if err := mesh.Encode(io.Discard); err == nil {
+			t.Errorf("got no error for %d vertices and a water mask of %d bytes", len(mesh.Vertices), len(mesh.WaterMask))
+		}
+	}
+}
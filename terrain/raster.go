@@ -0,0 +1,303 @@
+package terrain
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+)
+
+// rasterTileSize is the size of the tiles resampled from the rasters
+const rasterTileSize = 512
+
+// rasterMaxDownsampling is the number of zoom levels a raster level can be used below its native zoom
+const rasterMaxDownsampling = 4
+
+// rasterMaxUpsampling is the number of zoom levels tiles are interpolated above the native zoom of the rasters
+const rasterMaxUpsampling = 6
+
+// rasterGrid is a georeferenced elevation grid in EPSG:4326 (lon/lat)
+type rasterGrid struct {
+	path string
+	// west and north are the outer edges of the top left pixel
+	west, north float64
+	// pixelWidth and pixelHeight are the pixel sizes in degrees of the full resolution
+	pixelWidth, pixelHeight float64
+	width, height           int
+	nodata                  float64
+	hasNodata               bool
+	// levels contains the full resolution (first) and the overviews (decreasing resolution)
+	levels []*rasterLevel
+}
+
+// rasterLevel is a single resolution of a raster, which is split into blocks read on demand
+type rasterLevel struct {
+	width, height           int
+	blockWidth, blockHeight int
+	// readBlock reads the block at the given block column and row (row-major values)
+	readBlock func(col, row int) ([]float32, error)
+}
+
+func (g *rasterGrid) Bound() orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{g.west, g.north - float64(g.height)*g.pixelHeight},
+		Max: orb.Point{g.west + float64(g.width)*g.pixelWidth, g.north},
+	}
+}
+
+// levelFor returns the coarsest level which is still at least as fine as the resolution (degrees per pixel)
+func (g *rasterGrid) levelFor(resolution float64) *rasterLevel {
+	selected := g.levels[0]
+	for _, level := range g.levels[1:] {
+		if g.pixelWidth*float64(g.width)/float64(level.width) > resolution {
+			break
+		}
+		selected = level
+	}
+	return selected
+}
+
+// nativeZoom returns the zoom level at which a tile pixel is at least as fine as the level's pixel
+func (g *rasterGrid) nativeZoom(level *rasterLevel) int {
+	resolution := g.pixelWidth * float64(g.width) / float64(level.width)
+	return int(math.Ceil(math.Log2(360 / (resolution * rasterTileSize))))
+}
+
+// rasterSampler samples a raster level, caching the blocks read for a single tile
+type rasterSampler struct {
+	grid                    *rasterGrid
+	level                   *rasterLevel
+	pixelWidth, pixelHeight float64
+	blocks                  map[[2]int][]float32
+}
+
+func newRasterSampler(grid *rasterGrid, level *rasterLevel) *rasterSampler {
+	return &rasterSampler{
+		grid:        grid,
+		level:       level,
+		pixelWidth:  grid.pixelWidth * float64(grid.width) / float64(level.width),
+		pixelHeight: grid.pixelHeight * float64(grid.height) / float64(level.height),
+		blocks:      make(map[[2]int][]float32),
+	}
+}
+
+func (s *rasterSampler) value(x, y int) (float32, bool, error) {
+	col, row := x/s.level.blockWidth, y/s.level.blockHeight
+	block, ok := s.blocks[[2]int{col, row}]
+	if !ok {
+		var err error
+		block, err = s.level.readBlock(col, row)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read block %d/%d of %s: %w", col, row, s.grid.path, err)
+		}
+		s.blocks[[2]int{col, row}] = block
+	}
+
+	index := (y%s.level.blockHeight)*s.level.blockWidth + x%s.level.blockWidth
+	if index >= len(block) {
+		return 0, false, nil
+	}
+
+	value := block[index]
+	if math.IsNaN(float64(value)) || (s.grid.hasNodata && value == float32(s.grid.nodata)) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// sample returns the bilinear interpolated elevation at the point, ignoring nodata pixels
+func (s *rasterSampler) sample(lon, lat float64) (float32, bool, error) {
+	// Pixel position relative to the pixel centers
+	px := (lon-s.grid.west)/s.pixelWidth - 0.5
+	py := (s.grid.north-lat)/s.pixelHeight - 0.5
+
+	x0 := int(math.Floor(px))
+	y0 := int(math.Floor(py))
+	fx := px - float64(x0)
+	fy := py - float64(y0)
+
+	var sum, totalWeight float64
+	for dy := 0; dy <= 1; dy++ {
+		for dx := 0; dx <= 1; dx++ {
+			x := min(max(x0+dx, 0), s.level.width-1)
+			y := min(max(y0+dy, 0), s.level.height-1)
+
+			weight := (1 - math.Abs(float64(dx)-fx)) * (1 - math.Abs(float64(dy)-fy))
+			if weight <= 0 {
+				continue
+			}
+
+			value, ok, err := s.value(x, y)
+			if err != nil {
+				return 0, false, err
+			}
+			if !ok {
+				continue
+			}
+
+			sum += float64(value) * weight
+			totalWeight += weight
+		}
+	}
+
+	if totalWeight == 0 {
+		return 0, false, nil
+	}
+	return float32(sum / totalWeight), true, nil
+}
+
+// RasterSource resamples georeferenced DEM files in EPSG:4326 (SRTM .hgt, ESRI ASCII
+// grids .asc and (Cloud-Optimized) GeoTIFFs .tif) on the fly into web mercator tiles.
+// Where rasters overlap, the finest resolution wins. Areas without data are set to the fill value.
+type RasterSource struct {
+	root    string
+	fill    float32
+	grids   []*rasterGrid
+	minZoom uint32
+	maxZoom uint32
+}
+
+// NewRasterSource indexes all supported raster files in the directory (or the single file),
+// areas without data are set to fill (usually 0 for sea level)
+func NewRasterSource(root string, fill float32) (*RasterSource, error) {
+	source := &RasterSource{root: root, fill: fill}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		var grid *rasterGrid
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".hgt":
+			grid, err = openHGT(path)
+		case ".asc":
+			grid, err = openASCIIGrid(path)
+		case ".tif", ".tiff":
+			grid, err = openGeoTIFFRaster(path)
+		default:
+			return nil
+		}
+		if err != nil {
+			log.Printf("WARNING: skipping raster %s: %v", path, err)
+			return nil
+		}
+
+		source.grids = append(source.grids, grid)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index rasters: %w", err)
+	}
+
+	if len(source.grids) == 0 {
+		return nil, fmt.Errorf("no rasters found in %s", root)
+	}
+
+	// Finest resolution first, so it is preferred when rasters overlap
+	sort.SliceStable(source.grids, func(i, j int) bool {
+		return source.grids[i].pixelWidth < source.grids[j].pixelWidth
+	})
+
+	minZoom, maxZoom := math.MaxInt, 0
+	for _, grid := range source.grids {
+		maxZoom = max(maxZoom, grid.nativeZoom(grid.levels[0]))
+		minZoom = min(minZoom, grid.nativeZoom(grid.levels[len(grid.levels)-1])-rasterMaxDownsampling)
+	}
+	source.minZoom = uint32(max(minZoom, 0))
+	source.maxZoom = uint32(max(maxZoom, 0))
+
+	log.Printf("Indexed %d rasters in %s", len(source.grids), root)
+
+	return source, nil
+}
+
+func (s *RasterSource) Name() string {
+	return "raster"
+}
+
+func (s *RasterSource) MinZoom() uint32 {
+	return s.minZoom
+}
+
+func (s *RasterSource) MaxZoom() uint32 {
+	return s.maxZoom
+}
+
+func (s *RasterSource) MaxTileZoom() uint32 {
+	return s.maxZoom + rasterMaxUpsampling
+}
+
+func (s *RasterSource) TileSize() int {
+	return rasterTileSize
+}
+
+// GetElevationMap resamples the rasters covering the tile, zoom levels above MaxZoom are interpolated
+func (s *RasterSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if coord.Z < s.MinZoom() || coord.Z > s.MaxTileZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+
+	return globalCache.GetOrCreate(ctx, s.root, coord, func(ctx context.Context) (*ElevationMap, error) {
+		tile := CreateTileBounds(coord.Z, coord.Y, coord.X, rasterTileSize)
+		bound := tile.Bound()
+		resolution := (tile.MaxLon - tile.MinLon) / rasterTileSize
+
+		samplers := make([]*rasterSampler, 0)
+		for _, grid := range s.grids {
+			if grid.Bound().Intersects(bound) {
+				samplers = append(samplers, newRasterSampler(grid, grid.levelFor(resolution)))
+			}
+		}
+
+		elevationMap := newEmptyElevationMap(rasterTileSize)
+		if s.fill != 0 {
+			for _, row := range elevationMap.Data {
+				for x := range row {
+					row[x] = s.fill
+				}
+			}
+		}
+		if len(samplers) == 0 {
+			return elevationMap, nil
+		}
+
+		for y := 0; y < rasterTileSize; y++ {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			lat := tile.GetPixelLat(y)
+			for x := 0; x < rasterTileSize; x++ {
+				lon := tile.GetPixelLng(x)
+				point := orb.Point{lon, lat}
+
+				for _, sampler := range samplers {
+					if !sampler.grid.Bound().Contains(point) {
+						continue
+					}
+
+					value, ok, err := sampler.sample(lon, lat)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						elevationMap.Data[y][x] = value
+						break
+					}
+				}
+			}
+		}
+
+		return elevationMap, nil
+	})
+}
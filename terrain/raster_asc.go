@@ -0,0 +1,159 @@
+package terrain
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// asciiGridHeader contains the header values of an ESRI ASCII grid
+type asciiGridHeader struct {
+	cols, rows           int
+	x, y                 float64
+	center               bool
+	cellSize             float64
+	nodata               float64
+	hasNodata            bool
+	headerLines          int
+	hasCols, hasRows     bool
+	hasX, hasY, hasCells bool
+}
+
+// openASCIIGrid indexes an ESRI ASCII grid (.asc). As the format does not allow random access,
+// the values are loaded completely on first use and kept in memory.
+func openASCIIGrid(path string) (*rasterGrid, error) {
+	header, err := readASCIIGridHeader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	west := header.x
+	south := header.y
+	if header.center {
+		west -= header.cellSize / 2
+		south -= header.cellSize / 2
+	}
+
+	var once sync.Once
+	var values []float32
+	var loadErr error
+
+	level := &rasterLevel{
+		width:       header.cols,
+		height:      header.rows,
+		blockWidth:  header.cols,
+		blockHeight: header.rows,
+	}
+	level.readBlock = func(col, row int) ([]float32, error) {
+		once.Do(func() {
+			values, loadErr = readASCIIGridValues(path, header)
+		})
+		return values, loadErr
+	}
+
+	return &rasterGrid{
+		path:        path,
+		west:        west,
+		north:       south + float64(header.rows)*header.cellSize,
+		pixelWidth:  header.cellSize,
+		pixelHeight: header.cellSize,
+		width:       header.cols,
+		height:      header.rows,
+		nodata:      header.nodata,
+		hasNodata:   header.hasNodata,
+		levels:      []*rasterLevel{level},
+	}, nil
+}
+
+func readASCIIGridHeader(path string) (*asciiGridHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := &asciiGridHeader{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			break
+		}
+
+		// The header ends with the first line of values
+		key := strings.ToLower(fields[0])
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			break
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header value for %s: %w", key, err)
+		}
+
+		switch key {
+		case "ncols":
+			header.cols, header.hasCols = int(value), true
+		case "nrows":
+			header.rows, header.hasRows = int(value), true
+		case "xllcorner", "xllcenter":
+			header.x, header.hasX = value, true
+			header.center = key == "xllcenter"
+		case "yllcorner", "yllcenter":
+			header.y, header.hasY = value, true
+		case "cellsize":
+			header.cellSize, header.hasCells = value, true
+		case "nodata_value":
+			header.nodata, header.hasNodata = value, true
+		}
+		header.headerLines++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !header.hasCols || !header.hasRows || !header.hasX || !header.hasY || !header.hasCells {
+		return nil, fmt.Errorf("incomplete ASCII grid header")
+	}
+
+	return header, nil
+}
+
+func readASCIIGridValues(path string, header *asciiGridHeader) ([]float32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Skip the header lines
+	reader := bufio.NewReader(file)
+	for i := 0; i < header.headerLines; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanWords)
+	values := make([]float32, 0, header.cols*header.rows)
+	for scanner.Scan() && len(values) < cap(values) {
+		value, err := strconv.ParseFloat(scanner.Text(), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %w", scanner.Text(), err)
+		}
+		values = append(values, float32(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(values) != header.cols*header.rows {
+		return nil, fmt.Errorf("expected %d values, found %d", header.cols*header.rows, len(values))
+	}
+
+	return values, nil
+}
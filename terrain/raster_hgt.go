@@ -0,0 +1,90 @@
+package terrain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	hgtNodata      = -32768
+	hgtBlockHeight = 64
+)
+
+var hgtNamePattern = regexp.MustCompile(`^([NS])(\d{2})([EW])(\d{3})$`)
+
+// openHGT indexes a SRTM .hgt file, the georeferencing is taken from the file name (e.g. N47E008.hgt)
+func openHGT(path string) (*rasterGrid, error) {
+	name := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	match := hgtNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("invalid HGT file name %s", filepath.Base(path))
+	}
+
+	lat, _ := strconv.Atoi(match[2])
+	if match[1] == "S" {
+		lat = -lat
+	}
+	lon, _ := strconv.Atoi(match[4])
+	if match[3] == "W" {
+		lon = -lon
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are square grids of big-endian int16 (1201 or 3601 samples per row)
+	size := int(math.Sqrt(float64(info.Size() / 2)))
+	if size < 2 || int64(size*size*2) != info.Size() {
+		return nil, fmt.Errorf("invalid HGT file size %d", info.Size())
+	}
+
+	// The samples are located on the (inclusive) degree lines, so the pixels overlap the edges by half a pixel
+	pixelSize := 1.0 / float64(size-1)
+
+	level := &rasterLevel{
+		width:       size,
+		height:      size,
+		blockWidth:  size,
+		blockHeight: hgtBlockHeight,
+	}
+	level.readBlock = func(col, row int) ([]float32, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		rows := min(hgtBlockHeight, size-row*hgtBlockHeight)
+		data := make([]byte, rows*size*2)
+		if _, err := file.ReadAt(data, int64(row*hgtBlockHeight*size*2)); err != nil {
+			return nil, err
+		}
+
+		values := make([]float32, rows*size)
+		for i := range values {
+			values[i] = float32(int16(binary.BigEndian.Uint16(data[i*2:])))
+		}
+		return values, nil
+	}
+
+	return &rasterGrid{
+		path:        path,
+		west:        float64(lon) - pixelSize/2,
+		north:       float64(lat+1) + pixelSize/2,
+		pixelWidth:  pixelSize,
+		pixelHeight: pixelSize,
+		width:       size,
+		height:      size,
+		nodata:      hgtNodata,
+		hasNodata:   true,
+		levels:      []*rasterLevel{level},
+	}, nil
+}
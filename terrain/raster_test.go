@@ -0,0 +1,245 @@
+package terrain
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures in testdata/raster:
+//   - N47E008.hgt: 3x3 samples (100 to 900 row by row), void in the center
+//   - grid.asc: 4x3 cells of 0.5° centered at 7°E 45°N, nodata in the top right corner
+//   - strip.tif: 6x4 int16 pixels of 0.5°x0.25° from 8°E 47°N in 2 strips, value 100*y+x, GDAL nodata -9999
+//     at (2, 1)
+//   - tiled.tif: big-endian 16x16 int16 pixels (value 1000+16*y+x) of 0.125° in 8x8 tiles (deflate, horizontal
+//     predictor) as pixel is point at 10°E 50°N, with a 8x8 float32 overview (value 5000.5+8*y+x, floating point
+//     predictor) and a mask
+
+func openTestRaster(t *testing.T, name string) *rasterGrid {
+	t.Helper()
+
+	path := filepath.Join("testdata", "raster", name)
+	var grid *rasterGrid
+	var err error
+	switch filepath.Ext(name) {
+	case ".hgt":
+		grid, err = openHGT(path)
+	case ".asc":
+		grid, err = openASCIIGrid(path)
+	default:
+		grid, err = openGeoTIFFRaster(path)
+	}
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", name, err)
+	}
+	return grid
+}
+
+func checkGeoreferencing(t *testing.T, grid *rasterGrid, west, north, pixelWidth, pixelHeight float64, width, height int) {
+	t.Helper()
+
+	const epsilon = 1e-9
+	if math.Abs(grid.west-west) > epsilon || math.Abs(grid.north-north) > epsilon {
+		t.Errorf("got origin %v/%v, want %v/%v", grid.west, grid.north, west, north)
+	}
+	if math.Abs(grid.pixelWidth-pixelWidth) > epsilon || math.Abs(grid.pixelHeight-pixelHeight) > epsilon {
+		t.Errorf("got pixel size %vx%v, want %vx%v", grid.pixelWidth, grid.pixelHeight, pixelWidth, pixelHeight)
+	}
+	if grid.width != width || grid.height != height {
+		t.Errorf("got size %dx%d, want %dx%d", grid.width, grid.height, width, height)
+	}
+}
+
+// checkValues compares the values of the level, NaN for nodata pixels
+func checkValues(t *testing.T, grid *rasterGrid, level *rasterLevel, want func(x, y int) float32) {
+	t.Helper()
+
+	sampler := newRasterSampler(grid, level)
+	for y := 0; y < level.height; y++ {
+		for x := 0; x < level.width; x++ {
+			value, ok, err := sampler.value(x, y)
+			if err != nil {
+				t.Fatalf("pixel %d/%d: %v", x, y, err)
+			}
+
+			expected := want(x, y)
+			if expected != expected {
+				if ok {
+					t.Errorf("pixel %d/%d: got %v, want nodata", x, y, value)
+				}
+			} else if !ok || value != expected {
+				t.Errorf("pixel %d/%d: got %v (data %v), want %v", x, y, value, ok, expected)
+			}
+		}
+	}
+}
+
+func TestOpenHGT(t *testing.T) {
+	grid := openTestRaster(t, "N47E008.hgt")
+
+	// The samples are on the degree lines, so the pixels extend half a pixel beyond
+	checkGeoreferencing(t, grid, 7.75, 48.25, 0.5, 0.5, 3, 3)
+	checkValues(t, grid, grid.levels[0], func(x, y int) float32 {
+		if x == 1 && y == 1 {
+			return float32(math.NaN())
+		}
+		return float32(100 * (y*3 + x + 1))
+	})
+
+	// The corners of the file are exactly on the samples
+	value, ok, err := newRasterSampler(grid, grid.levels[0]).sample(9, 47)
+	if err != nil || !ok || value != 900 {
+		t.Errorf("got %v (data %v, error %v) at the south east corner, want 900", value, ok, err)
+	}
+}
+
+func TestOpenASCIIGrid(t *testing.T) {
+	grid := openTestRaster(t, "grid.asc")
+
+	checkGeoreferencing(t, grid, 6.75, 46.25, 0.5, 0.5, 4, 3)
+	checkValues(t, grid, grid.levels[0], func(x, y int) float32 {
+		switch {
+		case x == 3 && y == 0:
+			return float32(math.NaN())
+		case x == 3 && y == 2:
+			return 12.5
+		}
+		return float32(y*4 + x + 1)
+	})
+}
+
+func TestOpenGeoTIFFRasterStrips(t *testing.T) {
+	grid := openTestRaster(t, "strip.tif")
+
+	checkGeoreferencing(t, grid, 8, 47, 0.5, 0.25, 6, 4)
+	if !grid.hasNodata || grid.nodata != -9999 {
+		t.Errorf("got nodata %v (%v), want -9999", grid.nodata, grid.hasNodata)
+	}
+	if len(grid.levels) != 1 || grid.levels[0].blockHeight != 2 {
+		t.Fatalf("got %d levels, want a single level with strips of 2 rows", len(grid.levels))
+	}
+
+	checkValues(t, grid, grid.levels[0], func(x, y int) float32 {
+		if x == 2 && y == 1 {
+			return float32(math.NaN())
+		}
+		return float32(100*y + x)
+	})
+
+	// Interpolated between the pixel centers, the nodata pixel is left out
+	sampler := newRasterSampler(grid, grid.levels[0])
+	value, ok, err := sampler.sample(8.5, 46.75)
+	if err != nil || !ok || value != 50.5 {
+		t.Errorf("got %v (data %v, error %v) between 4 pixels, want 50.5", value, ok, err)
+	}
+	value, ok, err = sampler.sample(9.5, 46.75)
+	if err != nil || !ok || math.Abs(float64(value)-(2+3+103)/3.0) > 1e-4 {
+		t.Errorf("got %v (data %v, error %v) next to nodata, want %v", value, ok, err, (2+3+103)/3.0)
+	}
+}
+
+func TestOpenGeoTIFFRasterTiles(t *testing.T) {
+	grid := openTestRaster(t, "tiled.tif")
+
+	// Pixel is point, so the tiepoint is the center of the top left pixel
+	checkGeoreferencing(t, grid, 10-0.0625, 50+0.0625, 0.125, 0.125, 16, 16)
+	if grid.hasNodata {
+		t.Errorf("got nodata %v, want none", grid.nodata)
+	}
+
+	// The mask is not an overview
+	if len(grid.levels) != 2 || grid.levels[0].width != 16 || grid.levels[1].width != 8 {
+		t.Fatalf("got %d levels, want the full resolution and one overview", len(grid.levels))
+	}
+	if grid.levels[0].blockWidth != 8 || grid.levels[0].blockHeight != 8 {
+		t.Errorf("got blocks of %dx%d, want the 8x8 tiles", grid.levels[0].blockWidth, grid.levels[0].blockHeight)
+	}
+
+	checkValues(t, grid, grid.levels[0], func(x, y int) float32 {
+		return float32(1000 + 16*y + x)
+	})
+	checkValues(t, grid, grid.levels[1], func(x, y int) float32 {
+		return 5000.5 + float32(8*y+x)
+	})
+}
+
+func TestRasterOverviewSelection(t *testing.T) {
+	grid := openTestRaster(t, "tiled.tif")
+
+	tests := []struct {
+		resolution float64
+		width      int
+	}{
+		{0.01, 16},
+		{0.125, 16},
+		{0.2, 16},
+		{0.25, 8},
+		{1, 8},
+	}
+	for _, test := range tests {
+		if level := grid.levelFor(test.resolution); level.width != test.width {
+			t.Errorf("resolution %v: got level of width %d, want %d", test.resolution, level.width, test.width)
+		}
+	}
+
+	if zoom := grid.nativeZoom(grid.levels[0]); zoom != 3 {
+		t.Errorf("got native zoom %d of the full resolution, want 3", zoom)
+	}
+	if zoom := grid.nativeZoom(grid.levels[1]); zoom != 2 {
+		t.Errorf("got native zoom %d of the overview, want 2", zoom)
+	}
+}
+
+func TestRasterSourceZoomLevels(t *testing.T) {
+	source, err := NewRasterSource(filepath.Join("testdata", "raster"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source.MinZoom() != 0 || source.MaxZoom() != 3 || source.MaxTileZoom() != 3+rasterMaxUpsampling {
+		t.Errorf("got zoom levels %d-%d (up to %d), want 0-3 (up to %d)",
+			source.MinZoom(), source.MaxZoom(), source.MaxTileZoom(), 3+rasterMaxUpsampling)
+	}
+
+	// The finest raster is used first
+	if filepath.Base(source.grids[0].path) != "tiled.tif" {
+		t.Errorf("got %s as first raster, want tiled.tif", source.grids[0].path)
+	}
+
+	// The tile 3/4/2 covers tiled.tif, which has a gradient of 8 per degree west to east and 128 north to south
+	ctx := context.Background()
+	em, err := source.GetElevationMap(ctx, TileCoord{Z: 3, X: 4, Y: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if em.TileSize != source.TileSize() {
+		t.Errorf("got tile size %d, want %d", em.TileSize, source.TileSize())
+	}
+	tile := CreateTileBounds(3, 2, 4, em.TileSize)
+	checked := 0
+	for y := 0; y < em.TileSize; y++ {
+		lat := tile.GetPixelLat(y)
+		for x := 0; x < em.TileSize; x++ {
+			lng := tile.GetPixelLng(x)
+			if lng < 10 || lng > 11.75 || lat > 50 || lat < 48.25 {
+				continue
+			}
+			want := 1000 + 16*((50.0625-lat)/0.125-0.5) + ((lng-9.9375)/0.125 - 0.5)
+			if got := float64(em.GetElevation(x, y)); math.Abs(got-want) > 1e-2 {
+				t.Fatalf("pixel %d/%d at %v/%v: got %v, want %v", x, y, lng, lat, got, want)
+			}
+			checked++
+		}
+	}
+	if checked == 0 {
+		t.Fatalf("no pixels of the tile within the raster")
+	}
+
+	if _, err := source.GetElevationMap(ctx, TileCoord{Z: source.MaxTileZoom(), X: 0, Y: 0}); err != nil {
+		t.Errorf("got error %v at the max tile zoom", err)
+	}
+	if _, err := source.GetElevationMap(ctx, TileCoord{Z: source.MaxTileZoom() + 1}); err == nil {
+		t.Errorf("got no error beyond the max tile zoom")
+	}
+}
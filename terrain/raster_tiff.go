@@ -0,0 +1,505 @@
+package terrain
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF tags used to read (Cloud-Optimized) GeoTIFFs
+const (
+	tiffTagNewSubfileType  = 254
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagTileByteCounts  = 325
+	tiffTagSampleFormat    = 339
+	tiffTagPixelScale      = 33550
+	tiffTagTiepoint        = 33922
+	tiffTagGeoKeyDirectory = 34735
+	tiffTagGDALNodata      = 42113
+
+	geoKeyModelType  = 1024
+	geoKeyRasterType = 1025
+
+	geoModelTypeProjected = 1
+	geoRasterPixelIsPoint = 2
+)
+
+// tiffIFD is a single image (full resolution, overview or mask) of a TIFF file
+type tiffIFD struct {
+	tags map[uint16]tiffValue
+}
+
+// tiffValue holds the (numeric or ascii) values of a TIFF tag
+type tiffValue struct {
+	numbers []float64
+	text    string
+}
+
+func (ifd *tiffIFD) number(tag uint16, fallback float64) float64 {
+	if value, ok := ifd.tags[tag]; ok && len(value.numbers) > 0 {
+		return value.numbers[0]
+	}
+	return fallback
+}
+
+func (ifd *tiffIFD) numbers(tag uint16) []float64 {
+	return ifd.tags[tag].numbers
+}
+
+// tiffFile contains the parsed structure of a TIFF file
+type tiffFile struct {
+	path    string
+	order   binary.ByteOrder
+	bigTIFF bool
+	ifds    []*tiffIFD
+}
+
+// openGeoTIFFRaster indexes a GeoTIFF in EPSG:4326. Only the IFDs are read upfront, the pixel
+// data is read per internal tile (or strip), using the overviews of Cloud-Optimized GeoTIFFs.
+func openGeoTIFFRaster(path string) (*rasterGrid, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tiff, err := readTIFFStructure(path, file)
+	if err != nil {
+		return nil, err
+	}
+
+	main := tiff.ifds[0]
+	scale := main.numbers(tiffTagPixelScale)
+	tiepoint := main.numbers(tiffTagTiepoint)
+	if len(scale) < 2 || len(tiepoint) < 6 {
+		return nil, errors.New("missing georeferencing (pixel scale and tiepoint)")
+	}
+
+	geoKeys := parseGeoKeys(main.numbers(tiffTagGeoKeyDirectory))
+	if geoKeys[geoKeyModelType] == geoModelTypeProjected {
+		return nil, errors.New("projected coordinate systems are not supported, expected EPSG:4326")
+	}
+
+	grid := &rasterGrid{
+		path:        path,
+		west:        tiepoint[3] - tiepoint[0]*scale[0],
+		north:       tiepoint[4] + tiepoint[1]*scale[1],
+		pixelWidth:  scale[0],
+		pixelHeight: scale[1],
+		width:       int(main.number(tiffTagImageWidth, 0)),
+		height:      int(main.number(tiffTagImageLength, 0)),
+	}
+	if geoKeys[geoKeyRasterType] == geoRasterPixelIsPoint {
+		grid.west -= scale[0] / 2
+		grid.north += scale[1] / 2
+	}
+
+	if nodata, ok := main.tags[tiffTagGDALNodata]; ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.Trim(nodata.text, "\x00")), 64)
+		if err == nil {
+			grid.nodata, grid.hasNodata = value, true
+		}
+	}
+
+	// The first IFD is the full resolution, further reduced resolution IFDs (not masks) are overviews
+	for i, ifd := range tiff.ifds {
+		subfileType := int(ifd.number(tiffTagNewSubfileType, 0))
+		if i > 0 && (subfileType&1 == 0 || subfileType&4 != 0) {
+			continue
+		}
+
+		level, err := tiff.level(ifd)
+		if err != nil {
+			return nil, err
+		}
+		grid.levels = append(grid.levels, level)
+	}
+
+	sort.SliceStable(grid.levels, func(i, j int) bool {
+		return grid.levels[i].width > grid.levels[j].width
+	})
+
+	return grid, nil
+}
+
+func readTIFFStructure(path string, file io.ReaderAt) (*tiffFile, error) {
+	header := make([]byte, 16)
+	if _, err := file.ReadAt(header[:8], 0); err != nil {
+		return nil, err
+	}
+
+	tiff := &tiffFile{path: path}
+	switch string(header[0:2]) {
+	case "II":
+		tiff.order = binary.LittleEndian
+	case "MM":
+		tiff.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+
+	var offset uint64
+	switch tiff.order.Uint16(header[2:4]) {
+	case 42:
+		offset = uint64(tiff.order.Uint32(header[4:8]))
+	case 43:
+		tiff.bigTIFF = true
+		if _, err := file.ReadAt(header, 0); err != nil {
+			return nil, err
+		}
+		offset = tiff.order.Uint64(header[8:16])
+	default:
+		return nil, errors.New("unsupported TIFF version")
+	}
+
+	// Follow the linked list of IFDs
+	for offset != 0 && len(tiff.ifds) < 64 {
+		ifd, next, err := tiff.readIFD(file, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IFD: %w", err)
+		}
+		tiff.ifds = append(tiff.ifds, ifd)
+		offset = next
+	}
+
+	if len(tiff.ifds) == 0 {
+		return nil, errors.New("TIFF contains no images")
+	}
+
+	return tiff, nil
+}
+
+func (t *tiffFile) readIFD(file io.ReaderAt, offset uint64) (*tiffIFD, uint64, error) {
+	countSize, entrySize, valueSize := 2, 12, 4
+	if t.bigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
+	buf := make([]byte, countSize)
+	if _, err := file.ReadAt(buf, int64(offset)); err != nil {
+		return nil, 0, err
+	}
+
+	count := uint64(0)
+	if t.bigTIFF {
+		count = t.order.Uint64(buf)
+	} else {
+		count = uint64(t.order.Uint16(buf))
+	}
+
+	entries := make([]byte, int(count)*entrySize+valueSize)
+	if _, err := file.ReadAt(entries, int64(offset)+int64(countSize)); err != nil {
+		return nil, 0, err
+	}
+
+	ifd := &tiffIFD{tags: make(map[uint16]tiffValue, count)}
+	for i := 0; i < int(count); i++ {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		tag := t.order.Uint16(entry[0:2])
+		dataType := t.order.Uint16(entry[2:4])
+
+		var valueCount uint64
+		var inline []byte
+		if t.bigTIFF {
+			valueCount = t.order.Uint64(entry[4:12])
+			inline = entry[12:20]
+		} else {
+			valueCount = uint64(t.order.Uint32(entry[4:8]))
+			inline = entry[8:12]
+		}
+
+		size := tiffTypeSize(dataType)
+		if size == 0 {
+			continue
+		}
+
+		// Values which don't fit into the entry are stored at an offset
+		data := inline
+		if valueCount*uint64(size) > uint64(valueSize) {
+			var valueOffset uint64
+			if t.bigTIFF {
+				valueOffset = t.order.Uint64(inline)
+			} else {
+				valueOffset = uint64(t.order.Uint32(inline))
+			}
+			data = make([]byte, valueCount*uint64(size))
+			if _, err := file.ReadAt(data, int64(valueOffset)); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		ifd.tags[tag] = t.parseValue(dataType, int(valueCount), data)
+	}
+
+	next := entries[int(count)*entrySize:]
+	if t.bigTIFF {
+		return ifd, t.order.Uint64(next), nil
+	}
+	return ifd, uint64(t.order.Uint32(next)), nil
+}
+
+func tiffTypeSize(dataType uint16) int {
+	switch dataType {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12, 16, 17, 18: // RATIONAL, SRATIONAL, DOUBLE, LONG8, SLONG8, IFD8
+		return 8
+	}
+	return 0
+}
+
+func (t *tiffFile) parseValue(dataType uint16, count int, data []byte) tiffValue {
+	if dataType == 2 {
+		return tiffValue{text: string(data[:count])}
+	}
+
+	numbers := make([]float64, count)
+	for i := range numbers {
+		switch dataType {
+		case 1, 7:
+			numbers[i] = float64(data[i])
+		case 6:
+			numbers[i] = float64(int8(data[i]))
+		case 3:
+			numbers[i] = float64(t.order.Uint16(data[i*2:]))
+		case 8:
+			numbers[i] = float64(int16(t.order.Uint16(data[i*2:])))
+		case 4:
+			numbers[i] = float64(t.order.Uint32(data[i*4:]))
+		case 9:
+			numbers[i] = float64(int32(t.order.Uint32(data[i*4:])))
+		case 11:
+			numbers[i] = float64(math.Float32frombits(t.order.Uint32(data[i*4:])))
+		case 5:
+			numbers[i] = float64(t.order.Uint32(data[i*8:])) / float64(t.order.Uint32(data[i*8+4:]))
+		case 10:
+			numbers[i] = float64(int32(t.order.Uint32(data[i*8:]))) / float64(int32(t.order.Uint32(data[i*8+4:])))
+		case 12:
+			numbers[i] = math.Float64frombits(t.order.Uint64(data[i*8:]))
+		case 16, 18:
+			numbers[i] = float64(t.order.Uint64(data[i*8:]))
+		case 17:
+			numbers[i] = float64(int64(t.order.Uint64(data[i*8:])))
+		}
+	}
+	return tiffValue{numbers: numbers}
+}
+
+// parseGeoKeys returns the inline (short) values of the GeoKeyDirectory
+func parseGeoKeys(directory []float64) map[int]int {
+	keys := make(map[int]int)
+	if len(directory) < 4 {
+		return keys
+	}
+
+	for i := 0; i < int(directory[3]) && 4+i*4+3 < len(directory); i++ {
+		entry := directory[4+i*4 : 8+i*4]
+		if entry[1] == 0 {
+			keys[int(entry[0])] = int(entry[3])
+		}
+	}
+	return keys
+}
+
+// level creates a raster level of an IFD, reading its tiles (or strips) on demand
+func (t *tiffFile) level(ifd *tiffIFD) (*rasterLevel, error) {
+	width := int(ifd.number(tiffTagImageWidth, 0))
+	height := int(ifd.number(tiffTagImageLength, 0))
+	bitsPerSample := int(ifd.number(tiffTagBitsPerSample, 1))
+	sampleFormat := int(ifd.number(tiffTagSampleFormat, 1))
+	samplesPerPixel := int(ifd.number(tiffTagSamplesPerPixel, 1))
+	compression := int(ifd.number(tiffTagCompression, 1))
+	predictor := int(ifd.number(tiffTagPredictor, 1))
+
+	if width == 0 || height == 0 {
+		return nil, errors.New("invalid image size")
+	}
+	if samplesPerPixel > 1 && int(ifd.number(tiffTagPlanarConfig, 1)) != 1 {
+		return nil, errors.New("planar separated multi-band images are not supported")
+	}
+
+	blockWidth, blockHeight := width, int(ifd.number(tiffTagRowsPerStrip, float64(height)))
+	offsets, byteCounts := ifd.numbers(tiffTagStripOffsets), ifd.numbers(tiffTagStripByteCounts)
+	if _, tiled := ifd.tags[tiffTagTileWidth]; tiled {
+		blockWidth = int(ifd.number(tiffTagTileWidth, 0))
+		blockHeight = int(ifd.number(tiffTagTileLength, 0))
+		offsets, byteCounts = ifd.numbers(tiffTagTileOffsets), ifd.numbers(tiffTagTileByteCounts)
+	}
+	if blockWidth == 0 || blockHeight == 0 || len(offsets) == 0 || len(offsets) != len(byteCounts) {
+		return nil, errors.New("invalid tile or strip layout")
+	}
+	blockHeight = min(blockHeight, height)
+
+	decodeSample, err := tiffSampleDecoder(t.order, bitsPerSample, sampleFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	blocksPerRow := (width + blockWidth - 1) / blockWidth
+	bytesPerSample := bitsPerSample / 8
+
+	level := &rasterLevel{
+		width:       width,
+		height:      height,
+		blockWidth:  blockWidth,
+		blockHeight: blockHeight,
+	}
+	level.readBlock = func(col, row int) ([]float32, error) {
+		index := row*blocksPerRow + col
+		if index >= len(offsets) {
+			return nil, fmt.Errorf("block %d out of range", index)
+		}
+
+		values := make([]float32, blockWidth*blockHeight)
+		if byteCounts[index] == 0 {
+			// Sparse files don't store empty blocks
+			for i := range values {
+				values[i] = float32(math.NaN())
+			}
+			return values, nil
+		}
+
+		file, err := os.Open(t.path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		raw := make([]byte, int(byteCounts[index]))
+		if _, err := file.ReadAt(raw, int64(offsets[index])); err != nil {
+			return nil, err
+		}
+
+		data, err := tiffDecompress(compression, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		rowSize := blockWidth * samplesPerPixel * bytesPerSample
+		rows := min(blockHeight, len(data)/rowSize)
+		for y := 0; y < rows; y++ {
+			rowData := data[y*rowSize : (y+1)*rowSize]
+
+			switch predictor {
+			case 2:
+				tiffUndoHorizontalPredictor(t.order, rowData, bytesPerSample, samplesPerPixel)
+			case 3:
+				rowData = tiffUndoFloatingPointPredictor(rowData, bytesPerSample, t.order)
+			}
+
+			// Only the first band is used
+			for x := 0; x < blockWidth; x++ {
+				values[y*blockWidth+x] = decodeSample(rowData[(x*samplesPerPixel)*bytesPerSample:])
+			}
+		}
+
+		return values[:rows*blockWidth], nil
+	}
+
+	return level, nil
+}
+
+func tiffSampleDecoder(order binary.ByteOrder, bitsPerSample, sampleFormat int) (func([]byte) float32, error) {
+	switch {
+	case bitsPerSample == 8 && sampleFormat == 1:
+		return func(b []byte) float32 { return float32(b[0]) }, nil
+	case bitsPerSample == 8 && sampleFormat == 2:
+		return func(b []byte) float32 { return float32(int8(b[0])) }, nil
+	case bitsPerSample == 16 && sampleFormat == 1:
+		return func(b []byte) float32 { return float32(order.Uint16(b)) }, nil
+	case bitsPerSample == 16 && sampleFormat == 2:
+		return func(b []byte) float32 { return float32(int16(order.Uint16(b))) }, nil
+	case bitsPerSample == 32 && sampleFormat == 1:
+		return func(b []byte) float32 { return float32(order.Uint32(b)) }, nil
+	case bitsPerSample == 32 && sampleFormat == 2:
+		return func(b []byte) float32 { return float32(int32(order.Uint32(b))) }, nil
+	case bitsPerSample == 32 && sampleFormat == 3:
+		return func(b []byte) float32 { return math.Float32frombits(order.Uint32(b)) }, nil
+	case bitsPerSample == 64 && sampleFormat == 3:
+		return func(b []byte) float32 { return float32(math.Float64frombits(order.Uint64(b))) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sample format (%d bits, format %d)", bitsPerSample, sampleFormat)
+}
+
+func tiffDecompress(compression int, data []byte) ([]byte, error) {
+	switch compression {
+	case 1:
+		return data, nil
+	case 5:
+		reader := lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8)
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case 8, 32946:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return nil, fmt.Errorf("unsupported TIFF compression %d", compression)
+}
+
+// tiffUndoHorizontalPredictor reverts the integer differencing (predictor 2) of a row in place
+func tiffUndoHorizontalPredictor(order binary.ByteOrder, row []byte, bytesPerSample, samplesPerPixel int) {
+	stride := samplesPerPixel * bytesPerSample
+	for i := stride; i+bytesPerSample <= len(row); i += bytesPerSample {
+		switch bytesPerSample {
+		case 1:
+			row[i] += row[i-stride]
+		case 2:
+			order.PutUint16(row[i:], order.Uint16(row[i:])+order.Uint16(row[i-stride:]))
+		case 4:
+			order.PutUint32(row[i:], order.Uint32(row[i:])+order.Uint32(row[i-stride:]))
+		case 8:
+			order.PutUint64(row[i:], order.Uint64(row[i:])+order.Uint64(row[i-stride:]))
+		}
+	}
+}
+
+// tiffUndoFloatingPointPredictor reverts the byte differencing and shuffling (predictor 3) of a row
+func tiffUndoFloatingPointPredictor(row []byte, bytesPerSample int, order binary.ByteOrder) []byte {
+	for i := 1; i < len(row); i++ {
+		row[i] += row[i-1]
+	}
+
+	// The bytes are stored as planes, most significant byte first
+	count := len(row) / bytesPerSample
+	result := make([]byte, len(row))
+	for i := 0; i < count; i++ {
+		for b := 0; b < bytesPerSample; b++ {
+			if order == binary.LittleEndian {
+				result[i*bytesPerSample+b] = row[(bytesPerSample-1-b)*count+i]
+			} else {
+				result[i*bytesPerSample+b] = row[b*count+i]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package terrain
+
+import (
+	"fmt"
+	"math"
+)
+
+// SlopeMethod selects the finite difference kernel used for the terrain derivatives
+type SlopeMethod int
+
+const (
+	// SlopeHorn uses the weighted 3x3 kernel of Horn (1981), smoothing rough terrain (as GDAL by default)
+	SlopeHorn SlopeMethod = iota
+	// SlopeZevenbergenThorne uses the 4 direct neighbors (Zevenbergen & Thorne 1987), keeping more detail
+	SlopeZevenbergenThorne
+)
+
+// ParseSlopeMethod returns the slope method by name ("horn" or "zevenbergen-thorne")
+func ParseSlopeMethod(name string) (SlopeMethod, error) {
+	switch name {
+	case "", "horn":
+		return SlopeHorn, nil
+	case "zevenbergen-thorne", "zt":
+		return SlopeZevenbergenThorne, nil
+	}
+	return SlopeHorn, fmt.Errorf("unknown slope method %q", name)
+}
+
+// clampedElevation returns the elevation with the coordinates clamped to the map and its buffer
+// (edge pixels are repeated)
+func (em *ElevationMap) clampedElevation(x, y int) float64 {
+	x = min(max(x, -em.Buffer), em.TileSize+em.Buffer-1)
+	y = min(max(y, -em.Buffer), em.TileSize+em.Buffer-1)
+	return float64(em.Data[y+em.Buffer][x+em.Buffer])
+}
+
+// Gradient returns the elevation change per meter eastwards (dz/dx) and southwards (dz/dy)
+// at the pixel, for the given ground size of a pixel in meters
+func (em *ElevationMap) Gradient(x, y int, cellSize float64, method SlopeMethod) (dzdx, dzdy float64) {
+	if method == SlopeZevenbergenThorne {
+		dzdx = (em.clampedElevation(x+1, y) - em.clampedElevation(x-1, y)) / (2 * cellSize)
+		dzdy = (em.clampedElevation(x, y+1) - em.clampedElevation(x, y-1)) / (2 * cellSize)
+		return dzdx, dzdy
+	}
+
+	// Horn: a b c / d e f / g h i
+	a, b, c := em.clampedElevation(x-1, y-1), em.clampedElevation(x, y-1), em.clampedElevation(x+1, y-1)
+	d, f := em.clampedElevation(x-1, y), em.clampedElevation(x+1, y)
+	g, h, i := em.clampedElevation(x-1, y+1), em.clampedElevation(x, y+1), em.clampedElevation(x+1, y+1)
+
+	dzdx = ((c + 2*f + i) - (a + 2*d + g)) / (8 * cellSize)
+	dzdy = ((g + 2*h + i) - (a + 2*b + c)) / (8 * cellSize)
+	return dzdx, dzdy
+}
+
+// SlopeAspect returns the slope in degrees (0 is flat) and the aspect, the compass direction the
+// slope faces in degrees clockwise from north (-1 for flat terrain)
+func SlopeAspect(dzdx, dzdy float64) (slope, aspect float64) {
+	slope = math.Atan(math.Hypot(dzdx, dzdy)) * 180 / math.Pi
+	if dzdx == 0 && dzdy == 0 {
+		return slope, -1
+	}
+
+	// The downslope direction as (east, north) is (-dz/dx, dz/dy), as dz/dy points south
+	aspect = math.Atan2(-dzdx, dzdy) * 180 / math.Pi
+	if aspect < 0 {
+		aspect += 360
+	}
+	return slope, aspect
+}
+
+// Curvature returns the curvature of the surface at the pixel (Zevenbergen & Thorne) in 1/100 meters,
+// as used by ArcGIS: positive values are convex (ridges), negative values concave (valleys)
+func (em *ElevationMap) Curvature(x, y int, cellSize float64) float64 {
+	e := em.clampedElevation(x, y)
+	d := ((em.clampedElevation(x-1, y)+em.clampedElevation(x+1, y))/2 - e) / (cellSize * cellSize)
+	f := ((em.clampedElevation(x, y-1)+em.clampedElevation(x, y+1))/2 - e) / (cellSize * cellSize)
+	return -2 * (d + f) * 100
+}
+
+// Hillshade returns the illumination of a surface with the gradient (0 is dark, 1 is fully lit)
+// for a sun at the azimuth (degrees clockwise from north) and altitude (degrees above the horizon).
+// The zFactor exaggerates the elevation.
+func Hillshade(dzdx, dzdy, azimuth, altitude, zFactor float64) float64 {
+	zenith := (90 - altitude) * math.Pi / 180
+	// Convert the geographic azimuth to the mathematical angle
+	azimuthMath := math.Mod(360-azimuth+90, 360) * math.Pi / 180
+
+	slope := math.Atan(zFactor * math.Hypot(dzdx, dzdy))
+
+	aspect := 0.0
+	if dzdx != 0 || dzdy != 0 {
+		aspect = math.Atan2(dzdy, -dzdx)
+		if aspect < 0 {
+			aspect += 2 * math.Pi
+		}
+	}
+
+	shade := math.Cos(zenith)*math.Cos(slope) + math.Sin(zenith)*math.Sin(slope)*math.Cos(azimuthMath-aspect)
+	return math.Max(0, math.Min(1, shade))
+}
+
+// ComputeHillshade calculates the illumination (see Hillshade) of every pixel of the tile,
+// using the real ground size of the pixels at their latitude
+func ComputeHillshade(em *ElevationMap, tile *TileBounds, method SlopeMethod, azimuth, altitude, zFactor float64) [][]float32 {
+	shade := make([][]float32, em.TileSize)
+	for y := 0; y < em.TileSize; y++ {
+		cellSize := tile.GetPixelSize(y)
+
+		shade[y] = make([]float32, em.TileSize)
+		for x := 0; x < em.TileSize; x++ {
+			dzdx, dzdy := em.Gradient(x, y, cellSize, method)
+			shade[y][x] = float32(Hillshade(dzdx, dzdy, azimuth, altitude, zFactor))
+		}
+	}
+	return shade
+}
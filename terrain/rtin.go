@@ -0,0 +1,118 @@
+package terrain
+
+import (
+	"fmt"
+	"math"
+)
+
+// GridMesh is a triangulation of a height grid, vertices are grid coordinates (x to the right, y downwards)
+type GridMesh struct {
+	Vertices  [][2]int
+	Triangles [][3]int
+}
+
+// TriangulateGrid creates a right-triangulated irregular network (RTIN, as the Martini library of Mapbox) of a
+// square grid of heights, with 2^n+1 values per row. Triangles are split until the height error of their
+// hypotenuse midpoint is at most maxError, so flat areas get few large triangles.
+func TriangulateGrid(heights []float32, gridSize int, maxError float32) (*GridMesh, error) {
+	tileSize := gridSize - 1
+	if tileSize < 1 || tileSize&(tileSize-1) != 0 {
+		return nil, fmt.Errorf("grid size must be 2^n+1, got %d", gridSize)
+	}
+	if len(heights) != gridSize*gridSize {
+		return nil, fmt.Errorf("expected %d heights, got %d", gridSize*gridSize, len(heights))
+	}
+
+	errors := rtinErrors(heights, gridSize)
+
+	mesh := &GridMesh{}
+	indices := make([]int, gridSize*gridSize)
+
+	vertex := func(x, y int) int {
+		index := y*gridSize + x
+		if indices[index] == 0 {
+			mesh.Vertices = append(mesh.Vertices, [2]int{x, y})
+			indices[index] = len(mesh.Vertices)
+		}
+		return indices[index] - 1
+	}
+
+	var split func(ax, ay, bx, by, cx, cy int)
+	split = func(ax, ay, bx, by, cx, cy int) {
+		// Middle of the hypotenuse (a, b), c is the right angle
+		mx, my := (ax+bx)/2, (ay+by)/2
+		if abs(ax-cx)+abs(ay-cy) > 1 && errors[my*gridSize+mx] > maxError {
+			split(cx, cy, ax, ay, mx, my)
+			split(bx, by, cx, cy, mx, my)
+			return
+		}
+		mesh.Triangles = append(mesh.Triangles, [3]int{vertex(ax, ay), vertex(bx, by), vertex(cx, cy)})
+	}
+	split(0, 0, tileSize, tileSize, tileSize, 0)
+	split(tileSize, tileSize, 0, 0, 0, tileSize)
+
+	return mesh, nil
+}
+
+// rtinErrors calculates the error of each grid point as midpoint of a hypotenuse, including the errors of
+// the smaller triangles, bottom up over all triangles of the hierarchy
+func rtinErrors(heights []float32, gridSize int) []float32 {
+	tileSize := gridSize - 1
+	triangles := tileSize*tileSize*2 - 2
+	parents := triangles - tileSize*tileSize
+
+	errors := make([]float32, gridSize*gridSize)
+	for i := triangles - 1; i >= 0; i-- {
+		ax, ay, bx, by := rtinTriangle(i, tileSize)
+
+		mx, my := (ax+bx)/2, (ay+by)/2
+		cx, cy := mx+my-ay, my+ax-mx
+
+		middle := my*gridSize + mx
+		interpolated := (heights[ay*gridSize+ax] + heights[by*gridSize+bx]) / 2
+		errors[middle] = max(errors[middle], float32(math.Abs(float64(interpolated-heights[middle]))))
+
+		if i < parents {
+			left := ((ay+cy)/2)*gridSize + (ax+cx)/2
+			right := ((by+cy)/2)*gridSize + (bx+cx)/2
+			errors[middle] = max(errors[middle], errors[left], errors[right])
+		}
+	}
+	return errors
+}
+
+// rtinTriangle returns the hypotenuse of the triangle with the index, the triangles are numbered level by level
+// (as a binary tree with the two halves of the grid as roots)
+func rtinTriangle(i, tileSize int) (ax, ay, bx, by int) {
+	id := i + 2
+	var cx, cy int
+	if id&1 != 0 {
+		// Bottom left half of the grid
+		bx, by, cx = tileSize, tileSize, tileSize
+	} else {
+		// Top right half of the grid
+		ax, ay, cy = tileSize, tileSize, tileSize
+	}
+
+	for id >>= 1; id > 1; id >>= 1 {
+		mx, my := (ax+bx)/2, (ay+by)/2
+		if id&1 != 0 {
+			// Left half
+			bx, by = ax, ay
+			ax, ay = cx, cy
+		} else {
+			// Right half
+			ax, ay = bx, by
+			bx, by = cx, cy
+		}
+		cx, cy = mx, my
+	}
+	return ax, ay, bx, by
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
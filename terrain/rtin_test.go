@@ -0,0 +1,111 @@
+package terrain
+
+import (
+	"math"
+	"testing"
+)
+
+// testHeights returns a grid of a smooth hill on a slope
+func testHeights(gridSize int) []float32 {
+	heights := make([]float32, gridSize*gridSize)
+	for y := 0; y < gridSize; y++ {
+		for x := 0; x < gridSize; x++ {
+			dx, dy := float64(x)/float64(gridSize-1)-0.4, float64(y)/float64(gridSize-1)-0.6
+			heights[y*gridSize+x] = float32(500*math.Exp(-(dx*dx+dy*dy)*8) + 100*float64(x)/float64(gridSize-1))
+		}
+	}
+	return heights
+}
+
+// meshHeight interpolates the height of the grid point from the triangle, reporting whether the point is
+// within the triangle
+func meshHeight(mesh *GridMesh, heights []float32, gridSize int, triangle [3]int, x, y int) (float64, bool) {
+	a, b, c := mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]]
+	area := float64((b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0]))
+	wa := float64((b[0]-x)*(c[1]-y)-(b[1]-y)*(c[0]-x)) / area
+	wb := float64((c[0]-x)*(a[1]-y)-(c[1]-y)*(a[0]-x)) / area
+	wc := 1 - wa - wb
+	if wa < 0 || wb < 0 || wc < 0 {
+		return 0, false
+	}
+
+	height := func(vertex [2]int) float64 { return float64(heights[vertex[1]*gridSize+vertex[0]]) }
+	return wa*height(a) + wb*height(b) + wc*height(c), true
+}
+
+func TestTriangulateGridErrorBound(t *testing.T) {
+	const gridSize = 33
+	heights := testHeights(gridSize)
+
+	previousTriangles := 0
+	for _, maxError := range []float32{100, 20, 5, 1, 0} {
+		mesh, err := TriangulateGrid(heights, gridSize, maxError)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The triangles cover the grid without overlapping
+		area := 0
+		for _, triangle := range mesh.Triangles {
+			a, b, c := mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]]
+			area += abs((b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0]))
+		}
+		if area != 2*(gridSize-1)*(gridSize-1) {
+			t.Errorf("max error %v: got triangles of area %v, want %d", maxError, float64(area)/2, (gridSize-1)*(gridSize-1))
+		}
+		if len(mesh.Triangles) < previousTriangles {
+			t.Errorf("max error %v: got %d triangles, want more than the %d of a larger error", maxError, len(mesh.Triangles), previousTriangles)
+		}
+		previousTriangles = len(mesh.Triangles)
+
+		// Each grid point is within the max error of the mesh
+		covered := make([]bool, len(heights))
+		for _, triangle := range mesh.Triangles {
+			for y := 0; y < gridSize; y++ {
+				for x := 0; x < gridSize; x++ {
+					height, ok := meshHeight(mesh, heights, gridSize, triangle, x, y)
+					if !ok {
+						continue
+					}
+					covered[y*gridSize+x] = true
+					if deviation := math.Abs(height - float64(heights[y*gridSize+x])); deviation > float64(maxError)+1e-3 {
+						t.Fatalf("max error %v: point %d/%d is %v off the mesh", maxError, x, y, deviation)
+					}
+				}
+			}
+		}
+		for i, ok := range covered {
+			if !ok {
+				t.Fatalf("max error %v: point %d/%d is not covered", maxError, i%gridSize, i/gridSize)
+			}
+		}
+
+		if maxError == 0 && len(mesh.Vertices) != gridSize*gridSize {
+			t.Errorf("got %d vertices without error, want all %d grid points", len(mesh.Vertices), gridSize*gridSize)
+		}
+	}
+}
+
+func TestTriangulateGridFlat(t *testing.T) {
+	const gridSize = 17
+	heights := make([]float32, gridSize*gridSize)
+	for i := range heights {
+		heights[i] = 42
+	}
+
+	mesh, err := TriangulateGrid(heights, gridSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Vertices) != 4 || len(mesh.Triangles) != 2 {
+		t.Errorf("got %d vertices and %d triangles for a flat grid, want 4 and 2", len(mesh.Vertices), len(mesh.Triangles))
+	}
+}
+
+func TestTriangulateGridInvalid(t *testing.T) {
+	for _, test := range []struct{ heights, gridSize int }{{1, 1}, {16, 4}, {100, 10}, {24, 5}} {
+		if _, err := TriangulateGrid(make([]float32, test.heights), test.gridSize, 1); err == nil {
+			t.Errorf("grid size %d with %d heights: got no error", test.gridSize, test.heights)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package terrain
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ElevationSource provides the elevation data for a requested tile
+type ElevationSource interface {
+	// Name identifies the source (e.g. for logging and cache keys)
+	Name() string
+	// MinZoom is the lowest zoom level of the elevation maps
+	MinZoom() uint32
+	// MaxZoom is the highest zoom level of the elevation maps with the full resolution of the data
+	MaxZoom() uint32
+	// MaxTileZoom is the highest zoom level GetElevationMap serves, above MaxZoom the maps are interpolated
+	MaxTileZoom() uint32
+	// TileSize is the size in pixels of the elevation maps (e.g. 512 for maps composed of 4 upstream tiles)
+	TileSize() int
+	// GetElevationMap returns the elevation map covering the given tile
+	GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error)
+}
+
+// NewElevationSource creates a source from a spec in the form "<kind>[:<location>][#<options>]",
+// e.g. "terrarium", "geotiff:https://example.com/geotiff/{z}/{x}/{y}.tif" or
+// "xyz:https://example.com/{z}/{x}/{y}.png#encoding=mapbox". The options are query encoded,
+// the "encoding" option selects the ElevationDecoder of sources with encoded image tiles.
+// When no location is given, the public AWS elevation tiles are used.
+func NewElevationSource(spec string) (ElevationSource, error) {
+	kind, location, _ := strings.Cut(spec, ":")
+	location, rawOptions, _ := strings.Cut(location, "#")
+
+	options, err := url.ParseQuery(rawOptions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options for elevation source %q: %w", kind, err)
+	}
+	encoding := options.Get("encoding")
+
+	switch kind {
+	case "terrarium", "terrain-rgb", "xyz":
+		if location == "" && kind != "terrarium" {
+			return nil, fmt.Errorf("elevation source %q requires a URL", kind)
+		}
+		if location == "" {
+			location = terrariumSourceURL
+		}
+		if encoding == "" {
+			encoding = "terrarium"
+			if kind == "terrain-rgb" {
+				encoding = "mapbox"
+			}
+		}
+		decoder, err := GetElevationDecoder(encoding)
+		if err != nil {
+			return nil, err
+		}
+		return NewXYZSource(location, decoder), nil
+	case "geotiff":
+		if location == "" {
+			location = geotiffSourceURL
+		}
+		return NewGeoTIFFSource(location), nil
+	case "dir":
+		if location == "" {
+			return nil, fmt.Errorf("elevation source %q requires a directory", kind)
+		}
+		if encoding == "" {
+			encoding = "terrarium"
+		}
+		decoder, err := GetElevationDecoder(encoding)
+		if err != nil {
+			return nil, err
+		}
+		return NewDirectorySource(location, decoder)
+	case "mbtiles":
+		if location == "" {
+			return nil, fmt.Errorf("elevation source %q requires an archive path", kind)
+		}
+		return NewMBTilesSource(location, encoding)
+	case "pmtiles":
+		if location == "" {
+			return nil, fmt.Errorf("elevation source %q requires an archive path", kind)
+		}
+		return NewPMTilesSource(location, encoding)
+	case "raster":
+		if location == "" {
+			return nil, fmt.Errorf("elevation source %q requires a directory", kind)
+		}
+		fill := 0.0
+		if value := options.Get("nodata"); value != "" {
+			fill, err = strconv.ParseFloat(value, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nodata option %q: %w", value, err)
+			}
+		}
+		return NewRasterSource(location, float32(fill))
+	case "composite":
+		if location == "" {
+			return nil, fmt.Errorf("elevation source %q requires a config file", kind)
+		}
+		return NewCompositeSource(location)
+	}
+
+	return nil, fmt.Errorf("unknown elevation source %q", kind)
+}
+
+// formatTileTemplate fills the {z}, {x} and {y} placeholders of a tile URL or path template
+func formatTileTemplate(template string, coord TileCoord) string {
+	return strings.NewReplacer(
+		"{z}", strconv.FormatUint(uint64(coord.Z), 10),
+		"{x}", strconv.FormatUint(uint64(coord.X), 10),
+		"{y}", strconv.FormatUint(uint64(coord.Y), 10),
+	).Replace(template)
+}
@@ -1,4 +1,4 @@
-package main
+package terrain
 
 import (
 	"math"
@@ -16,6 +16,9 @@ type TileBounds struct {
 	MaxLon  float64
 	xLookup []float64
 	yLookup []float64
+	// Projected mercator range, to calculate pixels outside of the tile (e.g. buffer pixels)
+	mercatorMinY   float64
+	mercatorDeltaY float64
 }
 
 func CreateTileBounds(zoom, tileY, tileX uint32, tileSize int) *TileBounds {
@@ -59,27 +62,57 @@ func CreateTileBounds(zoom, tileY, tileX uint32, tileSize int) *TileBounds {
 	}
 
 	return &TileBounds{
+		Zoom:    zoom,
+		TileX:   tileX,
+		TileY:   tileY,
 		MinLat:  minLat,
 		MaxLat:  maxLat,
 		MinLon:  minLon,
 		MaxLon:  maxLon,
 		xLookup: xLookup,
 		yLookup: yLookup,
+
+		mercatorMinY:   minY,
+		mercatorDeltaY: deltaY,
 	}
 }
 
+// GetPixelLat returns the latitude of the pixel row, rows outside of the tile are extrapolated
 func (tb *TileBounds) GetPixelLat(y int) float64 {
-	return tb.yLookup[y]
+	if y >= 0 && y < len(tb.yLookup) {
+		return tb.yLookup[y]
+	}
+
+	projectedY := tb.mercatorMinY + float64(y)/float64(len(tb.yLookup)-1)*tb.mercatorDeltaY
+	lat := (2*math.Atan(math.Exp(projectedY)) - math.Pi/2) * 180.0 / math.Pi
+	return math.Max(-85.0511, math.Min(85.0511, lat))
 }
 
+// GetPixelLng returns the longitude of the pixel column, columns outside of the tile are extrapolated
 func (tb *TileBounds) GetPixelLng(x int) float64 {
-	return tb.xLookup[x]
+	if x >= 0 && x < len(tb.xLookup) {
+		return tb.xLookup[x]
+	}
+
+	lon := tb.MinLon + float64(x)/float64(len(tb.xLookup))*(tb.MaxLon-tb.MinLon)
+	// Wrap around the antimeridian
+	return math.Mod(lon+540, 360) - 180
 }
 
+// GetLatLng returns the location of fractional pixel coordinates, interpolated like GetPixelLat and GetPixelLng
+func (tb *TileBounds) GetLatLng(x, y float64) (lat, lng float64) {
+	projectedY := tb.mercatorMinY + y/float64(len(tb.yLookup)-1)*tb.mercatorDeltaY
+	lat = (2*math.Atan(math.Exp(projectedY)) - math.Pi/2) * 180.0 / math.Pi
+
+	lng = tb.MinLon + x/float64(len(tb.xLookup))*(tb.MaxLon-tb.MinLon)
+	return math.Max(-85.0511, math.Min(85.0511, lat)), math.Mod(lng+540, 360) - 180
+}
+
+// Bound returns the geographic bounds of the tile (normalized, as MinLat holds the northern edge)
 func (tb *TileBounds) Bound() orb.Bound {
 	return orb.Bound{
-		Min: orb.Point{tb.MinLon, tb.MinLat},
-		Max: orb.Point{tb.MaxLon, tb.MaxLat},
+		Min: orb.Point{tb.MinLon, math.Min(tb.MinLat, tb.MaxLat)},
+		Max: orb.Point{tb.MaxLon, math.Max(tb.MinLat, tb.MaxLat)},
 	}
 }
 
@@ -107,3 +140,13 @@ func getTileLongitudes(z, x uint32) (minLon, maxLon float64) {
 
 	return minLon, maxLon
 }
+
+// earthCircumference is the equatorial circumference of the WGS84 ellipsoid in meters
+const earthCircumference = 2 * math.Pi * 6378137
+
+// GetPixelSize returns the ground size of a pixel in the given row in meters. As web mercator
+// is conformal, the width and height of a pixel are the same, shrinking with cos(latitude).
+func (tb *TileBounds) GetPixelSize(y int) float64 {
+	degreesPerPixel := (tb.MaxLon - tb.MinLon) / float64(len(tb.xLookup))
+	return degreesPerPixel / 360 * earthCircumference * math.Cos(tb.GetPixelLat(y)*math.Pi/180)
+}
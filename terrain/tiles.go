@@ -1,5 +1,6 @@
 package terrain
 
+// TileCoord is a web mercator tile coordinate, X is the column and Y the row
 type TileCoord struct {
 	Z, X, Y uint32
 }
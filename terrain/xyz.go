@@ -0,0 +1,220 @@
+package terrain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const terrariumSourceURL = "https://elevation-tiles-prod.s3.dualstack.us-east-1.amazonaws.com/terrarium/{z}/{x}/{y}.png"
+const tileSize = 256 // Standard tile size
+
+// xyzMaxZoom is the highest zoom level of the upstream tiles
+const xyzMaxZoom = 15
+
+// XYZSource fetches encoded DEM tiles (e.g. Terrarium PNG) over HTTP. A requested tile is
+// composed of the 4 subtiles of the next zoom level, doubling the resolution.
+type XYZSource struct {
+	url     string
+	decoder ElevationDecoder
+}
+
+// NewXYZSource creates a source for the given URL template (with {z}/{x}/{y} placeholders)
+func NewXYZSource(url string, decoder ElevationDecoder) *XYZSource {
+	return &XYZSource{url: url, decoder: decoder}
+}
+
+func (s *XYZSource) Name() string {
+	return "xyz"
+}
+
+func (s *XYZSource) MinZoom() uint32 {
+	return 0
+}
+
+// MaxZoom is one level below the upstream tiles, as the maps are composed of their subtiles
+func (s *XYZSource) MaxZoom() uint32 {
+	return xyzMaxZoom - 1
+}
+
+func (s *XYZSource) MaxTileZoom() uint32 {
+	return s.MaxZoom()
+}
+
+func (s *XYZSource) TileSize() int {
+	return 2 * tileSize
+}
+
+func (s *XYZSource) GetElevationMap(ctx context.Context, coord TileCoord) (*ElevationMap, error) {
+	if coord.Z > s.MaxZoom() {
+		return nil, fmt.Errorf("zoom level %d is not supported by source %s", coord.Z, s.Name())
+	}
+
+	return globalCache.GetOrCreate(ctx, s.url, coord, func(ctx context.Context) (*ElevationMap, error) {
+		tiles, err := fetchSubTiles(ctx, coord, func(ctx context.Context, coord TileCoord) (image.Image, error) {
+			return downloadTile(ctx, formatTileTemplate(s.url, coord))
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Error downloading subtiles: %v", err)
+			return nil, err
+		}
+
+		return newElevationMapFromImage(compositeImages(tiles, tileSize), s.decoder), nil
+	})
+}
+
+func downloadTile(ctx context.Context, url string) (image.Image, error) {
+	if tileDiskCache != nil {
+		if data, found := tileDiskCache.Get(url); found {
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err == nil {
+				return img, nil
+			}
+			log.Printf("Invalid cached tile %s: %v", url, err)
+			tileDiskCache.Delete(url)
+		}
+	}
+
+	maxRetries := 3
+	retryDelay := 200 * time.Millisecond
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt > 0 {
+			time.Sleep(retryDelay)
+			log.Printf("Retry attempt %d for tile %s", attempt, url)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			log.Printf("Download error (creating request) (attempt %d): %v", attempt+1, err)
+			continue
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			log.Printf("Download error (attempt %d): %v", attempt+1, err)
+			continue
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			log.Printf("HTTP error %d (attempt %d)", res.StatusCode, attempt+1)
+			continue
+		}
+
+		// Read response body
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			log.Printf("Read error (attempt %d): %v", attempt+1, err)
+			continue
+		}
+
+		// Decode image (PNG or WebP)
+		img, _, err := image.Decode(bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Decode error (attempt %d): %v", attempt+1, err)
+			continue
+		}
+
+		if tileDiskCache != nil {
+			if err := tileDiskCache.Set(url, body); err != nil {
+				log.Printf("WARNING: failed to write tile %s to disk cache: %v", url, err)
+			}
+		}
+
+		return img, nil
+	}
+
+	return nil, fmt.Errorf("failed to download tile after %d attempts", maxRetries)
+}
+
+// fetchSubTiles loads the 4 subtiles (next zoom level) of the parent tile concurrently
+func fetchSubTiles(ctx context.Context, parent TileCoord, fetch func(ctx context.Context, coord TileCoord) (image.Image, error)) ([]tileImage, error) {
+	childZ := parent.Z + 1
+	baseChildX := parent.X * 2
+	baseChildY := parent.Y * 2
+
+	var wg sync.WaitGroup
+	tiles := make([]tileImage, 4)
+	errors := make(chan error, 4)
+
+	// Fetch all 4 subtiles concurrently
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(index, offsetX, offsetY uint32) {
+				defer wg.Done()
+				coord := TileCoord{
+					Z: childZ,
+					X: baseChildX + offsetX,
+					Y: baseChildY + offsetY,
+				}
+				img, err := fetch(ctx, coord)
+				if err != nil {
+					errors <- err
+					return
+				}
+				tiles[index] = tileImage{Coord: coord, Image: img}
+			}(uint32(i*2+j), uint32(j), uint32(i))
+		}
+	}
+
+	// Wait for all fetches to complete
+	wg.Wait()
+	close(errors)
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Check for any errors
+	for err := range errors {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tiles, nil
+}
+
+type tileImage struct {
+	Coord TileCoord
+	Image image.Image
+}
+
+func compositeImages(tiles []tileImage, tileSize int) *image.RGBA64 {
+	// Create a new image with double the dimensions (16 bit per channel to keep Gray16 encodings)
+	combined := image.NewRGBA64(image.Rect(0, 0, tileSize*2, tileSize*2))
+
+	// Copy each tile into the correct position
+	for _, tile := range tiles {
+		bounds := tile.Image.Bounds()
+		offsetX := int(tile.Coord.X%2) * tileSize
+		offsetY := int(tile.Coord.Y%2) * tileSize
+
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				combined.Set(x+offsetX, y+offsetY, tile.Image.At(bounds.Min.X+x, bounds.Min.Y+y))
+			}
+		}
+	}
+
+	return combined
+}
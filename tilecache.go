@@ -0,0 +1,206 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mxzinke/colorful-terrarium/colors"
+	"github.com/mxzinke/colorful-terrarium/terrain"
+)
+
+// renderedTile is an encoded tile with the values for the conditional request headers
+type renderedTile struct {
+	key      string
+	data     []byte
+	etag     string
+	modified time.Time
+}
+
+// newRenderedTile creates the cached tile, its ETag is weak as the compression handler serves the same tile with
+// different content codings
+func newRenderedTile(key string, data []byte, modified time.Time) *renderedTile {
+	hash := sha256.Sum256(data)
+	return &renderedTile{
+		key:      key,
+		data:     data,
+		etag:     `W/"` + hex.EncodeToString(hash[:16]) + `"`,
+		modified: modified.UTC().Truncate(time.Second),
+	}
+}
+
+// TileCache caches the encoded output tiles in memory (LRU, bounded by bytes) and optionally on disk
+type TileCache struct {
+	namespace string
+	maxBytes  int64
+	disk      *terrain.DiskCache
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // Front is the most recently used tile
+	entries map[string]*list.Element
+
+	inFlightMu sync.Mutex
+	inFlight   map[string]*tileCall // Running renders
+}
+
+// tileCall is a running render of a tile, shared by all requests for the key
+type tileCall struct {
+	done    chan struct{} // Closed when tile and err are set
+	tile    *renderedTile
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// NewTileCache creates a tile cache, the namespace (e.g. the elevation source) is part of all keys.
+// A maxBytes of 0 disables the in-memory cache, disk is optional.
+func NewTileCache(namespace string, maxBytes int64, disk *terrain.DiskCache) *TileCache {
+	return &TileCache{
+		namespace: namespace,
+		maxBytes:  maxBytes,
+		disk:      disk,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+		inFlight:  make(map[string]*tileCall),
+	}
+}
+
+// tileKey identifies a tile of a provider in the format of the extension, the provider version and elevation
+// post-processing invalidate tiles of older releases
+func (c *TileCache) tileKey(provider colors.ColorProvider, extension string, z, x, y uint32) string {
+	return c.key(provider.Name(), colors.ProviderVersion(provider), colors.ProviderElevationOptions(provider), z, x, y, extension)
+}
+
+// key identifies a tile of the named output (e.g. a provider) in the version with the elevation post-processing
+func (c *TileCache) key(name, version string, elevation colors.ElevationOptions, z, x, y uint32, extension string) string {
+	return fmt.Sprintf("%s|%s@%s~%s/%d/%d/%d.%s", c.namespace, name, version, elevation, z, x, y, extension)
+}
+
+// Get returns the cached tile from memory or disk
+func (c *TileCache) Get(key string) (*renderedTile, bool) {
+	c.mu.Lock()
+	if element, exists := c.entries[key]; exists {
+		c.lru.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*renderedTile), true
+	}
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		if data, modified, found := c.disk.GetWithTime(key); found {
+			tile := newRenderedTile(key, data, modified)
+			c.store(tile)
+			return tile, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set caches the encoded tile and returns it with its ETag
+func (c *TileCache) Set(key string, data []byte) *renderedTile {
+	tile := newRenderedTile(key, data, time.Now())
+	c.store(tile)
+
+	if c.disk != nil {
+		if err := c.disk.Set(key, data); err != nil {
+			log.Printf("WARNING: failed to write tile %s to disk cache: %v", key, err)
+		}
+	}
+
+	return tile
+}
+
+// GetOrRender returns the cached tile, or renders and caches it. Concurrent requests for the same key share a
+// single render, which runs under a context detached from the requests: it is only cancelled when all waiting
+// requests are gone.
+func (c *TileCache) GetOrRender(ctx context.Context, key string, render func(ctx context.Context) ([]byte, error)) (*renderedTile, error) {
+	if tile, found := c.Get(key); found {
+		return tile, nil
+	}
+
+	// Join the running render or start a new one
+	c.inFlightMu.Lock()
+	call, exists := c.inFlight[key]
+	if exists {
+		call.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &tileCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.inFlight[key] = call
+		go c.render(callCtx, key, call, render)
+	}
+	c.inFlightMu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.tile, call.err
+	case <-ctx.Done():
+		c.inFlightMu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody is interested anymore, later requests start a new render
+			call.cancel()
+			if c.inFlight[key] == call {
+				delete(c.inFlight, key)
+			}
+		}
+		c.inFlightMu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// render renders the tile of a running call, caches it and publishes it to all waiters
+func (c *TileCache) render(ctx context.Context, key string, call *tileCall, render func(ctx context.Context) ([]byte, error)) {
+	defer call.cancel()
+
+	data, err := render(ctx)
+	var tile *renderedTile
+	if err == nil {
+		tile = c.Set(key, data)
+	}
+
+	c.inFlightMu.Lock()
+	call.tile, call.err = tile, err
+	if c.inFlight[key] == call {
+		delete(c.inFlight, key)
+	}
+	c.inFlightMu.Unlock()
+
+	close(call.done)
+}
+
+// store adds the tile to the in-memory cache, evicting the least recently used tiles if it is full
+func (c *TileCache) store(tile *renderedTile) {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[tile.key]; exists {
+		c.remove(element)
+	}
+
+	c.entries[tile.key] = c.lru.PushFront(tile)
+	c.size += int64(len(tile.data))
+
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes a tile from the in-memory cache. Must be called with the mutex held.
+func (c *TileCache) remove(element *list.Element) {
+	tile := element.Value.(*renderedTile)
+	c.lru.Remove(element)
+	delete(c.entries, tile.key)
+	c.size -= int64(len(tile.data))
+}
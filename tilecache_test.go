@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/handlers"
+)
+
+// waitForWaiters waits until the running render of the key has the number of waiting requests
+func waitForWaiters(t *testing.T, cache *TileCache, key string, waiters int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		cache.inFlightMu.Lock()
+		call := cache.inFlight[key]
+		joined := call != nil && call.waiters == waiters
+		cache.inFlightMu.Unlock()
+		if joined {
+			return
+		}
+	}
+	t.Fatalf("got no render of %s with %d waiting requests", key, waiters)
+}
+
+func TestTileCacheGetOrRenderShared(t *testing.T) {
+	cache := NewTileCache("test", 1<<20, nil)
+	release := make(chan struct{})
+	var renders atomic.Int32
+	render := func(ctx context.Context) ([]byte, error) {
+		renders.Add(1)
+		<-release
+		return []byte("tile"), nil
+	}
+
+	const requests = 8
+	tiles := make([]*renderedTile, requests)
+	var wg sync.WaitGroup
+	for i := range tiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if tiles[i], err = cache.GetOrRender(context.Background(), "key", render); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitForWaiters(t, cache, "key", requests)
+	close(release)
+	wg.Wait()
+
+	if count := renders.Load(); count != 1 {
+		t.Errorf("got %d renders for concurrent requests, want 1", count)
+	}
+	for i, tile := range tiles {
+		if tile == nil || string(tile.data) != "tile" {
+			t.Fatalf("request %d: got tile %v, want the rendered tile", i, tile)
+		}
+	}
+
+	// Later requests are served from the cache
+	if _, err := cache.GetOrRender(context.Background(), "key", render); err != nil || renders.Load() != 1 {
+		t.Errorf("got %d renders (error %v) for a cached tile, want 1", renders.Load(), err)
+	}
+}
+
+func TestTileCacheGetOrRenderCancel(t *testing.T) {
+	cache := NewTileCache("test", 1<<20, nil)
+	cancelled := make(chan struct{})
+	render := func(ctx context.Context) ([]byte, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	// The render continues while a request waits for it, and is cancelled when the last request is gone
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{first, second} {
+		go func() {
+			_, err := cache.GetOrRender(ctx, "key", render)
+			errs <- err
+		}()
+	}
+	waitForWaiters(t, cache, "key", 2)
+
+	cancelFirst()
+	<-errs
+	select {
+	case <-cancelled:
+		t.Fatal("render cancelled while a request is waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	<-errs
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("render not cancelled after all requests are gone")
+	}
+}
+
+func TestServeTileCompressedConditional(t *testing.T) {
+	cache := NewTileCache("test", 1<<20, nil)
+	handler := handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveTile(r.Context(), w, r, cache, "key", "max-age=60", "text/plain", func(ctx context.Context) ([]byte, error) {
+			return []byte(strings.Repeat("tile ", 100)), nil
+		})
+	}))
+
+	request := func(encoding, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/tile", nil)
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	identity, compressed := request("", ""), request("gzip", "")
+	etag := identity.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("got ETag %q, want a weak ETag for the different content codings", etag)
+	}
+	if compressed.Header().Get("Content-Encoding") != "gzip" || compressed.Header().Get("ETag") != etag {
+		t.Errorf("got %q encoded response with ETag %q, want gzip with %q",
+			compressed.Header().Get("Content-Encoding"), compressed.Header().Get("ETag"), etag)
+	}
+
+	for _, encoding := range []string{"", "gzip"} {
+		if w := request(encoding, etag); w.Code != http.StatusNotModified {
+			t.Errorf("encoding %q: got status %d for a matching ETag, want 304", encoding, w.Code)
+		}
+	}
+}